@@ -1,7 +1,10 @@
 package cmd
 
 import (
-	"agnos_demo/internal/helpers"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
 	"agnos_demo/internal/migrations"
 
 	"github.com/spf13/cobra"
@@ -11,23 +14,101 @@ var migrateDBCmd = &cobra.Command{
 	Use:   "migrate-db",
 	Short: "Run database migrations",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		number, _ := cmd.Flags().GetInt("number")
+		to, _ := cmd.Flags().GetInt("to")
+		if !cmd.Flags().Changed("to") {
+			to, _ = cmd.Flags().GetInt("number")
+		}
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
 		forceMigrate, _ := cmd.Flags().GetBool("force-migrate")
+		confirm, _ := cmd.Flags().GetString("confirm")
+		allowDrift, _ := cmd.Flags().GetBool("allow-drift")
+
+		logger, err := newLogger()
+		if err != nil {
+			return err
+		}
+
+		return migrations.Migrate(logger, dryRun, to, forceMigrate, confirm, allowDrift)
+	},
+}
+
+var migrateDBRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back database migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetInt("to")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		allowDrift, _ := cmd.Flags().GetBool("allow-drift")
+
+		logger, err := newLogger()
+		if err != nil {
+			return err
+		}
+
+		return migrations.Rollback(logger, dryRun, to, allowDrift)
+	},
+}
+
+var migrateDBCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create the next numbered pair of SQL migration files",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+
+		logger, err := newLogger()
+		if err != nil {
+			return err
+		}
+
+		return migrations.Create(logger, dir, args[0])
+	},
+}
 
-		logger, err := helpers.CreateLogger("info", nil, nil, "")
+var migrateDBStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending database migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := newLogger()
 		if err != nil {
 			return err
 		}
 
-		return migrations.Migrate(logger, dryRun, number, forceMigrate)
+		statuses, err := migrations.Status(logger)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NUMBER\tNAME\tSTATE\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Number, status.Name, status.State, appliedAt)
+		}
+		return w.Flush()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(migrateDBCmd)
+	migrateDBCmd.AddCommand(migrateDBRollbackCmd)
+	migrateDBCmd.AddCommand(migrateDBCreateCmd)
+	migrateDBCmd.AddCommand(migrateDBStatusCmd)
 
+	migrateDBCmd.Flags().Int("to", -1, "the migration to run forwards or backwards to; if not set, will run all migrations")
 	migrateDBCmd.Flags().Int("number", -1, "the migration to run forwards until; if not set, will run all migrations")
+	migrateDBCmd.Flags().MarkDeprecated("number", "use --to instead")
 	migrateDBCmd.Flags().Bool("dry-run", false, "print out migrations to be applied without running them")
-	migrateDBCmd.Flags().Bool("force-migrate", false, "drop all the tables before migrate the database")
+	migrateDBCmd.Flags().Bool("force-migrate", false, "back up the data, then drop all the tables before migrate the database")
+	migrateDBCmd.Flags().String("confirm", "", "the database name, required to force migrate outside the dev and test environments")
+	migrateDBCmd.Flags().Bool("allow-drift", false, "continue when applied migrations have changed, recording their new checksums")
+
+	migrateDBRollbackCmd.Flags().Int("to", -1, "the migration to roll back to, 0 for all; if not set, will roll back the latest migration")
+	migrateDBRollbackCmd.Flags().Bool("dry-run", false, "print out migrations to be rolled back without running them")
+	migrateDBRollbackCmd.Flags().Bool("allow-drift", false, "continue when applied migrations have changed, recording their new checksums")
+
+	migrateDBCreateCmd.Flags().String("dir", "internal/migrations/sql", "the directory of the SQL migration files")
 }
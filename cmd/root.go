@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 
+	"agnos_demo/internal/logging"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -27,6 +30,15 @@ func Execute() {
 	}
 }
 
+// newLogger returns the logger of a command, configured by the Log settings.
+func newLogger() (*slog.Logger, error) {
+	config, err := logging.InitConfig()
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stdout, config)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file (default is config.yaml)")
@@ -44,8 +56,26 @@ func initConfig() {
 	replacer := strings.NewReplacer(".", "_")
 	viper.SetEnvKeyReplacer(replacer)
 
+	viper.SetDefault("App.Environment", "production")
 	viper.SetDefault("Log.Level", "debug")
 	viper.SetDefault("Log.Color", true)
+	viper.SetDefault("Log.JSON", false)
+	viper.SetDefault("Auth.AccessTokenTTL", "15m")
+	viper.SetDefault("Auth.RefreshTokenTTL", "168h")
+	viper.SetDefault("Search.FuzzyThreshold", 0.25)
+	viper.SetDefault("API.AdminHost", "127.0.0.1")
+	viper.SetDefault("API.AdminPort", 9090)
+	viper.SetDefault("API.ProfilingPort", 6060)
+	viper.SetDefault("API.FHIRBaseURL", "http://localhost/fhir")
+	viper.SetDefault("API.ReadTimeout", "15s")
+	viper.SetDefault("API.WriteTimeout", "10s")
+	viper.SetDefault("Database.QueryTimeout", "5s")
+	viper.SetDefault("Tracing.Exporter", "none")
+	viper.SetDefault("Tracing.ServiceName", "agnos-demo")
+	viper.SetDefault("Tracing.Endpoint", "localhost:4318")
+	viper.SetDefault("Tracing.SampleRatio", 1.0)
+	viper.SetDefault("Migrations.LockTimeout", "5m")
+	viper.SetDefault("Migrations.BackupDir", "backups")
 
 	viper.AutomaticEnv()
 
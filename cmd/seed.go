@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"agnos_demo/internal/seed"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed <set>",
+	Short: "Load a named set of sample data",
+	Long:  seedSetsUsage(),
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		patients, _ := cmd.Flags().GetInt("patients")
+
+		logger, err := newLogger()
+		if err != nil {
+			return err
+		}
+
+		return seed.Seed(logger, args[0], viper.GetString("App.Environment"), seed.Options{
+			PatientsPerHospital: patients,
+		})
+	},
+}
+
+func seedSetsUsage() string {
+	var usage strings.Builder
+	usage.WriteString("Load a named set of sample data. Sets can be loaded repeatedly and only\nadd what is missing. Available sets:\n\n")
+	for _, set := range seed.Sets {
+		fmt.Fprintf(&usage, "  %-6s %s (environments: %s)\n", set.Name, set.Description, strings.Join(set.Environments, ", "))
+	}
+	return usage.String()
+}
+
+func init() {
+	rootCmd.AddCommand(seedCmd)
+
+	seedCmd.Flags().Int("patients", -1, "the number of synthetic patients to generate per hospital; if not set, will use the set's default")
+}
@@ -3,17 +3,21 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"agnos_demo/internal/database"
-	"agnos_demo/internal/helpers"
+	"agnos_demo/internal/metrics"
 	"agnos_demo/internal/routes"
 	"agnos_demo/internal/service"
+	"agnos_demo/internal/tracing"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var serveUserAPICmd = &cobra.Command{
@@ -21,19 +25,32 @@ var serveUserAPICmd = &cobra.Command{
 	Short: "Start User HTTP API server",
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		logger, err := helpers.CreateLogger("", nil, nil, "")
+		logger, err := newLogger()
 		if err != nil {
 			return err
 		}
 
-		// Connect DB with context
 		ctx := context.Background()
+		shutdownTracing, err := tracing.Setup(ctx, tracing.InitConfig())
+		if err != nil {
+			return err
+		}
+
+		// Connect DB with context
 		db, err := database.ConnectDB(ctx)
 		if err != nil {
-			logger.Fatalf("Failed to connect to database: %v", err)
+			logger.Error("Failed to connect to database", "error", err)
 			return err
 		}
 		defer db.Close()
+		logger.Info("Connected to database successfully")
+
+		if pool, ok := db.(metrics.PoolStatter); ok {
+			metrics.Registry.MustRegister(metrics.NewPoolCollector(pool))
+		}
+
+		// Each query gets its own deadline on top of the request's.
+		db = database.WithQueryTimeout(db, viper.GetDuration("Database.QueryTimeout"))
 
 		svc, err := service.NewService(
 			logger,
@@ -49,18 +66,54 @@ var serveUserAPICmd = &cobra.Command{
 			return err
 		}
 
-		router := routes.NewRouter(svc)
+		router := routes.NewRouter(svc, config)
 
 		// Init Http Server
 		HttpServer := http.Server{
 			Addr:              fmt.Sprintf(":%d", config.Port),
 			Handler:           router,
 			ReadHeaderTimeout: 15 * time.Second,
-			ReadTimeout:       15 * time.Second,
-			WriteTimeout:      10 * time.Second,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
 			IdleTimeout:       30 * time.Second,
 		}
 
+		// The admin port serves /metrics. It is not published through nginx,
+		// and only listens on loopback unless API.AdminHost says otherwise.
+		var AdminServer *http.Server
+		if config.AdminPort > 0 {
+			AdminServer = &http.Server{
+				Addr:              net.JoinHostPort(config.AdminHost, strconv.Itoa(config.AdminPort)),
+				Handler:           routes.NewAdminRouter(),
+				ReadHeaderTimeout: 15 * time.Second,
+			}
+			go func() {
+				logger.Info(fmt.Sprintf("Serving admin endpoints at http://%s", AdminServer.Addr))
+				if err := AdminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("Admin server listen and serve failed", "error", err)
+				}
+			}()
+		}
+
+		// pprof is served only on loopback, for someone on the host (or in
+		// the container) holding the admin token.
+		var ProfilingServer *http.Server
+		if config.EnableProfiling {
+			ProfilingServer = &http.Server{
+				Addr:              fmt.Sprintf("127.0.0.1:%d", config.ProfilingPort),
+				Handler:           routes.NewProfilingRouter(config.ProfilingToken),
+				ReadHeaderTimeout: 15 * time.Second,
+				// No WriteTimeout: CPU profiles and traces stream for as
+				// long as the client asks.
+			}
+			go func() {
+				logger.Info(fmt.Sprintf("Serving profiling endpoints at http://127.0.0.1:%d/debug/pprof/", config.ProfilingPort))
+				if err := ProfilingServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("Profiling server listen and serve failed", "error", err)
+				}
+			}()
+		}
+
 		// Waiting os signal
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
@@ -70,23 +123,36 @@ var serveUserAPICmd = &cobra.Command{
 			signal.Notify(quit, os.Interrupt)
 			<-quit
 
-			logger.Infof("Gracefully shutting down...")
+			logger.Info("Gracefully shutting down...")
 
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
 			if err := HttpServer.Shutdown(ctx); err != nil {
-				logger.Errorf("Server forced to shutdown: %v", err)
+				logger.Error("Server forced to shutdown", "error", err)
+			}
+			if AdminServer != nil {
+				if err := AdminServer.Shutdown(ctx); err != nil {
+					logger.Error("Admin server forced to shutdown", "error", err)
+				}
+			}
+			if ProfilingServer != nil {
+				if err := ProfilingServer.Shutdown(ctx); err != nil {
+					logger.Error("Profiling server forced to shutdown", "error", err)
+				}
+			}
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Error("Failed to flush traces", "error", err)
 			}
 
-			logger.Infof("Server exited properly")
+			logger.Info("Server exited properly")
 			os.Exit(0)
 		}()
 
 		// Start Server
-		logger.Infof("Serving HTTP API at http://127.0.0.1:%d", config.Port)
+		logger.Info(fmt.Sprintf("Serving HTTP API at http://127.0.0.1:%d", config.Port))
 		if err := HttpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Infof("HTTP server listen and serves failed: %v", err)
+			logger.Error("HTTP server listen and serve failed", "error", err)
 		}
 
 		return nil
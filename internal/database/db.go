@@ -3,12 +3,19 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"strconv"
 
+	"agnos_demo/internal/tracing"
+
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/spf13/viper"
 )
 
+// BatchSize is the number of rows bulk loads, such as the seed command's,
+// insert per statement.
+const BatchSize = 1000
+
 func ConnectDB(ctx context.Context) (DB, error) {
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		viper.GetString("Database.Host"),
@@ -18,7 +25,23 @@ func ConnectDB(ctx context.Context) (DB, error) {
 		viper.GetString("Database.Name"),
 	)
 
-	pool, err := pgxpool.New(ctx, dsn)
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database config: %w", err)
+	}
+
+	// Fuzzy patient search uses the pg_trgm % operator, whose cut-off is a
+	// session setting rather than a query argument.
+	threshold := strconv.FormatFloat(viper.GetFloat64("Search.FuzzyThreshold"), 'f', -1, 64)
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, "SELECT set_config('pg_trgm.similarity_threshold', $1, false)", threshold)
+		return err
+	}
+
+	// Queries made under a traced request become child spans of it.
+	config.ConnConfig.Tracer = tracing.NewQueryTracer()
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
@@ -28,6 +51,5 @@ func ConnectDB(ctx context.Context) (DB, error) {
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
 
-	log.Println("Connected to database successfully")
 	return pool, nil
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// WithQueryTimeout returns a DB that gives every query, including those run
+// in its transactions, at most timeout to complete. The deadline is added to
+// the caller's context, so a query still ends early when that is cancelled.
+// A timeout of zero or less returns db unchanged.
+func WithQueryTimeout(db DB, timeout time.Duration) DB {
+	if timeout <= 0 {
+		return db
+	}
+	return &timeoutDB{DB: db, timeout: timeout}
+}
+
+type timeoutDB struct {
+	DB
+	timeout time.Duration
+}
+
+func (db *timeoutDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := context.WithTimeout(ctx, db.timeout)
+	return &timeoutRow{Row: db.DB.QueryRow(ctx, sql, args...), cancel: cancel}
+}
+
+func (db *timeoutDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.timeout)
+	rows, err := db.DB.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (db *timeoutDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.timeout)
+	defer cancel()
+	return db.DB.Exec(ctx, sql, args...)
+}
+
+func (db *timeoutDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	beginCtx, cancel := context.WithTimeout(ctx, db.timeout)
+	defer cancel()
+	tx, err := db.DB.Begin(beginCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutTx{Tx: tx, timeout: db.timeout}, nil
+}
+
+// timeoutTx applies the query timeout to each statement of a transaction.
+type timeoutTx struct {
+	pgx.Tx
+	timeout time.Duration
+}
+
+func (tx *timeoutTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := context.WithTimeout(ctx, tx.timeout)
+	return &timeoutRow{Row: tx.Tx.QueryRow(ctx, sql, args...), cancel: cancel}
+}
+
+func (tx *timeoutTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, tx.timeout)
+	rows, err := tx.Tx.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (tx *timeoutTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, tx.timeout)
+	defer cancel()
+	return tx.Tx.Exec(ctx, sql, args...)
+}
+
+func (tx *timeoutTx) Commit(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, tx.timeout)
+	defer cancel()
+	return tx.Tx.Commit(ctx)
+}
+
+// timeoutRow releases the query's deadline once the row is scanned.
+type timeoutRow struct {
+	pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.Row.Scan(dest...)
+}
+
+// timeoutRows releases the query's deadline once the rows are read or closed.
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r *timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
@@ -0,0 +1,87 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"agnos_demo/internal/database"
+	"agnos_demo/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// captureContext records the context a query was run with.
+func captureContext(ctx *context.Context) func(mock.Arguments) {
+	return func(args mock.Arguments) {
+		*ctx = args.Get(0).(context.Context)
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	t.Run("Row", func(t *testing.T) {
+		mockDB, mockRow := new(mocks.MockDB), new(mocks.MockRow)
+		var queryCtx context.Context
+		mockDB.On("QueryRow", mock.Anything, "SELECT 1", mock.Anything).Run(captureContext(&queryCtx)).Return(mockRow)
+		mockRow.On("Scan", mock.Anything).Return(nil)
+
+		var n int
+		require.NoError(t, database.WithQueryTimeout(mockDB, time.Second).QueryRow(context.Background(), "SELECT 1").Scan(&n))
+
+		deadline, ok := queryCtx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+		// The deadline is released once the row is scanned
+		assert.ErrorIs(t, queryCtx.Err(), context.Canceled)
+	})
+
+	t.Run("Rows", func(t *testing.T) {
+		mockDB, mockRows := new(mocks.MockDB), new(mocks.MockRows)
+		var queryCtx context.Context
+		mockDB.On("Query", mock.Anything, "SELECT 1", mock.Anything).Run(captureContext(&queryCtx)).Return(mockRows, nil)
+		mockRows.On("Next").Return(true).Once()
+		mockRows.On("Next").Return(false).Once()
+
+		rows, err := database.WithQueryTimeout(mockDB, time.Second).Query(context.Background(), "SELECT 1")
+		require.NoError(t, err)
+		assert.True(t, rows.Next())
+		assert.NoError(t, queryCtx.Err())
+		assert.False(t, rows.Next())
+		assert.ErrorIs(t, queryCtx.Err(), context.Canceled)
+	})
+
+	t.Run("Caller cancellation", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		var queryCtx context.Context
+		mockDB.On("Exec", mock.Anything, "SELECT 1", mock.Anything).Run(func(args mock.Arguments) {
+			queryCtx = args.Get(0).(context.Context)
+			<-queryCtx.Done()
+		}).Return(nil, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := database.WithQueryTimeout(mockDB, time.Minute).Exec(ctx, "SELECT 1")
+		require.NoError(t, err)
+		assert.ErrorIs(t, context.Cause(queryCtx), context.Canceled)
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		var queryCtx context.Context
+		mockDB.On("Exec", mock.Anything, "SELECT pg_sleep(1)", mock.Anything).Run(func(args mock.Arguments) {
+			queryCtx = args.Get(0).(context.Context)
+			<-queryCtx.Done()
+		}).Return(nil, nil)
+
+		_, err := database.WithQueryTimeout(mockDB, 10*time.Millisecond).Exec(context.Background(), "SELECT pg_sleep(1)")
+		require.NoError(t, err)
+		assert.ErrorIs(t, context.Cause(queryCtx), context.DeadlineExceeded)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		assert.Same(t, mockDB, database.WithQueryTimeout(mockDB, 0))
+	})
+}
@@ -0,0 +1,137 @@
+// Package fhir defines the subset of FHIR R4 resources served by the API and
+// maps patients onto them.
+package fhir
+
+// Code systems and identifier systems used in the resources.
+const (
+	IdentifierTypeSystem = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	LanguageExtensionURL = "http://hl7.org/fhir/StructureDefinition/language"
+
+	// NationalIDSystem is the Thai national ID system of the TH Core
+	// implementation guide.
+	NationalIDSystem = "https://terms.sil-th.org/id/th-cid"
+	// PassportSystem identifies passport numbers. The issuing country is not
+	// recorded, so the system is local to this service.
+	PassportSystem = "urn:agnos:passport"
+	// HospitalNumberSystemPrefix is followed by the hospital ID, since
+	// hospital numbers are only unique within their hospital.
+	HospitalNumberSystemPrefix = "urn:agnos:hospital:"
+)
+
+type Patient struct {
+	ResourceType         string         `json:"resourceType"`
+	ID                   string         `json:"id"`
+	Identifier           []Identifier   `json:"identifier,omitempty"`
+	Active               bool           `json:"active"`
+	Name                 []HumanName    `json:"name,omitempty"`
+	Telecom              []ContactPoint `json:"telecom,omitempty"`
+	Gender               string         `json:"gender,omitempty"`
+	BirthDate            string         `json:"birthDate,omitempty"`
+	ManagingOrganization *Reference     `json:"managingOrganization,omitempty"`
+}
+
+type Identifier struct {
+	Use    string           `json:"use,omitempty"`
+	Type   *CodeableConcept `json:"type,omitempty"`
+	System string           `json:"system,omitempty"`
+	Value  string           `json:"value"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Extension []Extension `json:"extension,omitempty"`
+	Use       string      `json:"use,omitempty"`
+	Family    string      `json:"family,omitempty"`
+	Given     []string    `json:"given,omitempty"`
+}
+
+type Extension struct {
+	URL       string `json:"url"`
+	ValueCode string `json:"valueCode,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type Reference struct {
+	Reference string `json:"reference"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int64         `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string             `json:"fullUrl"`
+	Resource *Patient           `json:"resource"`
+	Search   *BundleEntrySearch `json:"search,omitempty"`
+}
+
+type BundleEntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+type Issue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// NewOperationOutcome returns an outcome with a single error issue. code is a
+// FHIR issue type such as "not-found" or "invalid".
+func NewOperationOutcome(code string, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []Issue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+// NewSearchBundle wraps one page of patients in a searchset bundle. baseURL is
+// the URL of the Patient endpoint, used for each entry's fullUrl; total is the
+// number of matches across all pages and nextURL is empty on the last page.
+func NewSearchBundle(baseURL string, selfURL string, nextURL string, total int64, patients []*Patient) *Bundle {
+	bundle := &Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Total:        total,
+		Link:         []BundleLink{{Relation: "self", URL: selfURL}},
+		Entry:        []BundleEntry{},
+	}
+	if nextURL != "" {
+		bundle.Link = append(bundle.Link, BundleLink{Relation: "next", URL: nextURL})
+	}
+	for _, p := range patients {
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  baseURL + "/" + p.ID,
+			Resource: p,
+			Search:   &BundleEntrySearch{Mode: "match"},
+		})
+	}
+	return bundle
+}
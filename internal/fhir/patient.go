@@ -0,0 +1,95 @@
+package fhir
+
+import (
+	"agnos_demo/internal/models"
+)
+
+// HospitalNumberSystem returns the identifier system of hospital numbers
+// issued by the given hospital.
+func HospitalNumberSystem(hospitalID string) string {
+	return HospitalNumberSystemPrefix + hospitalID + ":hn"
+}
+
+// NewPatient maps a patient registration onto a FHIR Patient. The logical id
+// is the registration id, so each hospital addresses its own registration.
+func NewPatient(p *models.Patient) *Patient {
+	patient := &Patient{
+		ResourceType: "Patient",
+		ID:           p.ID.String(),
+		Active:       true,
+		ManagingOrganization: &Reference{
+			Reference: "Organization/" + p.HospitalID.String(),
+		},
+	}
+
+	if p.PatientHN != "" {
+		patient.Identifier = append(patient.Identifier, newIdentifier("usual", "MR", HospitalNumberSystem(p.HospitalID.String()), p.PatientHN))
+	}
+	if p.NationalID != "" {
+		patient.Identifier = append(patient.Identifier, newIdentifier("official", "NI", NationalIDSystem, string(p.NationalID)))
+	}
+	if p.PassportID != "" {
+		patient.Identifier = append(patient.Identifier, newIdentifier("official", "PPN", PassportSystem, string(p.PassportID)))
+	}
+
+	// Thai and English names are separate names, told apart by language.
+	if name := newHumanName("th", string(p.FirstNameTH), string(p.MiddleNameTH), string(p.LastNameTH)); name != nil {
+		patient.Name = append(patient.Name, *name)
+	}
+	if name := newHumanName("en", string(p.FirstNameEN), string(p.MiddleNameEN), string(p.LastNameEN)); name != nil {
+		patient.Name = append(patient.Name, *name)
+	}
+
+	if p.PhoneNumber != "" {
+		patient.Telecom = append(patient.Telecom, ContactPoint{System: "phone", Value: string(p.PhoneNumber)})
+	}
+	if p.Email != "" {
+		patient.Telecom = append(patient.Telecom, ContactPoint{System: "email", Value: string(p.Email)})
+	}
+
+	switch p.Gender {
+	case "M":
+		patient.Gender = "male"
+	case "F":
+		patient.Gender = "female"
+	default:
+		patient.Gender = "unknown"
+	}
+
+	if p.DateOfBirth != nil && !p.DateOfBirth.IsZero() {
+		patient.BirthDate = p.DateOfBirth.Format("2006-01-02")
+	}
+
+	return patient
+}
+
+func newIdentifier(use string, typeCode string, system string, value string) Identifier {
+	return Identifier{
+		Use: use,
+		Type: &CodeableConcept{
+			Coding: []Coding{{System: IdentifierTypeSystem, Code: typeCode}},
+		},
+		System: system,
+		Value:  value,
+	}
+}
+
+// newHumanName returns nil when no part of the name is known.
+func newHumanName(language string, first string, middle string, last string) *HumanName {
+	var given []string
+	for _, part := range []string{first, middle} {
+		if part != "" {
+			given = append(given, part)
+		}
+	}
+	if len(given) == 0 && last == "" {
+		return nil
+	}
+
+	return &HumanName{
+		Extension: []Extension{{URL: LanguageExtensionURL, ValueCode: language}},
+		Use:       "official",
+		Family:    last,
+		Given:     given,
+	}
+}
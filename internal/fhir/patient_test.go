@@ -0,0 +1,81 @@
+package fhir
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPatient(t *testing.T) {
+	hospitalID := uuid.New()
+	p := &models.Patient{
+		ID:           uuid.New(),
+		HospitalID:   hospitalID,
+		PatientHN:    "HN00000001",
+		FirstNameTH:  "จอห์น",
+		LastNameTH:   "โด",
+		FirstNameEN:  "John",
+		MiddleNameEN: "M",
+		LastNameEN:   "Doe",
+		DateOfBirth:  &models.Date{Time: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Gender:       "M",
+		NationalID:   "1234567890121",
+		PassportID:   "AB123456",
+		PhoneNumber:  "+66812345678",
+	}
+
+	patient := NewPatient(p)
+
+	assert.Equal(t, "Patient", patient.ResourceType)
+	assert.Equal(t, p.ID.String(), patient.ID)
+	assert.Equal(t, "male", patient.Gender)
+	assert.Equal(t, "1980-01-01", patient.BirthDate)
+	assert.Equal(t, "Organization/"+hospitalID.String(), patient.ManagingOrganization.Reference)
+
+	assert.Len(t, patient.Identifier, 3)
+	assert.Equal(t, HospitalNumberSystem(hospitalID.String()), patient.Identifier[0].System)
+	assert.Equal(t, "MR", patient.Identifier[0].Type.Coding[0].Code)
+	assert.Equal(t, NationalIDSystem, patient.Identifier[1].System)
+	assert.Equal(t, "NI", patient.Identifier[1].Type.Coding[0].Code)
+	assert.Equal(t, "1234567890121", patient.Identifier[1].Value)
+	assert.Equal(t, "PPN", patient.Identifier[2].Type.Coding[0].Code)
+
+	assert.Len(t, patient.Name, 2)
+	assert.Equal(t, "th", patient.Name[0].Extension[0].ValueCode)
+	assert.Equal(t, "โด", patient.Name[0].Family)
+	assert.Equal(t, "en", patient.Name[1].Extension[0].ValueCode)
+	assert.Equal(t, []string{"John", "M"}, patient.Name[1].Given)
+
+	assert.Equal(t, []ContactPoint{{System: "phone", Value: "+66812345678"}}, patient.Telecom)
+}
+
+func TestNewPatientMinimal(t *testing.T) {
+	patient := NewPatient(&models.Patient{ID: uuid.New(), PassportID: "AB123456", FirstNameEN: "Jane"})
+
+	assert.Equal(t, "unknown", patient.Gender)
+	assert.Empty(t, patient.BirthDate)
+	assert.Len(t, patient.Name, 1)
+	assert.Len(t, patient.Identifier, 1)
+
+	data, err := json.Marshal(patient)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "telecom")
+	assert.NotContains(t, string(data), "birthDate")
+}
+
+func TestNewSearchBundle(t *testing.T) {
+	patient := NewPatient(&models.Patient{ID: uuid.New(), NationalID: "1234567890121"})
+
+	bundle := NewSearchBundle("https://example.com/fhir/Patient", "https://example.com/fhir/Patient?family=Doe", "", 1, []*Patient{patient})
+
+	assert.Equal(t, "searchset", bundle.Type)
+	assert.Equal(t, int64(1), bundle.Total)
+	assert.Len(t, bundle.Link, 1)
+	assert.Equal(t, "https://example.com/fhir/Patient/"+patient.ID, bundle.Entry[0].FullURL)
+	assert.Equal(t, "match", bundle.Entry[0].Search.Mode)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+	"agnos_demo/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit trail.
+const (
+	auditPatientSearch   = "patient.search"
+	auditPatientRead     = "patient.read"
+	auditPatientCreate   = "patient.create"
+	auditPatientUpdate   = "patient.update"
+	auditPatientDelete   = "patient.delete"
+	auditStaffLogin      = "staff.login"
+	auditStaffLogout     = "staff.logout"
+	auditStaffCreate     = "staff.create"
+	auditStaffDeactivate = "staff.deactivate"
+	auditTrailRead       = "audit.read"
+)
+
+// auditEntry describes what a request did. The acting staff member and their
+// hospital are taken from the access token unless set, e.g. at login.
+type auditEntry struct {
+	action        string
+	staffID       string
+	hospitalID    string
+	patientIDs    []uuid.UUID
+	targetStaffID *uuid.UUID
+	filters       map[string]string
+}
+
+// recordAudit appends an event to the audit trail.
+func (h *Handlers) recordAudit(ctx context.Context, c *gin.Context, entry auditEntry) error {
+	if entry.staffID == "" {
+		entry.staffID = c.GetString("user_id")
+	}
+	if entry.hospitalID == "" {
+		entry.hospitalID = c.GetString("hospital_id")
+	}
+	if entry.patientIDs == nil {
+		entry.patientIDs = []uuid.UUID{}
+	}
+	if entry.filters == nil {
+		entry.filters = map[string]string{}
+	}
+
+	return h.audit.Record(ctx, repository.AuditRecord{
+		StaffID:       entry.staffID,
+		HospitalID:    entry.hospitalID,
+		Action:        entry.action,
+		PatientIDs:    entry.patientIDs,
+		TargetStaffID: entry.targetStaffID,
+		Filters:       entry.filters,
+		RequestID:     c.GetString("req_id"),
+		IPAddress:     c.ClientIP(),
+	})
+}
+
+// auditWrite records an action that has already taken effect. Unlike reads,
+// which are refused when they cannot be audited, the response still reports
+// success, so a failure is logged for follow-up instead. The event is recorded
+// even if the client has gone away in the meantime.
+func (h *Handlers) auditWrite(ctx context.Context, c *gin.Context, entry auditEntry) {
+	if err := h.recordAudit(context.WithoutCancel(ctx), c, entry); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit action", "error", err, "action", entry.action)
+	}
+}
+
+// queryFilters returns the query parameters of a request for the audit trail.
+func queryFilters(c *gin.Context) map[string]string {
+	filters := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		filters[key] = strings.Join(values, ",")
+	}
+	return filters
+}
+
+// ListAuditEvents returns the audit trail of the caller's hospital, newest
+// first.
+func (h *Handlers) ListAuditEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID := c.GetString("hospital_id")
+	filter := repository.AuditFilter{HospitalID: hospitalID}
+
+	var errs validation.Errors
+	if staffID := c.Query("staff_id"); staffID != "" {
+		if id, err := uuid.Parse(staffID); err != nil {
+			errs = append(errs, validation.FieldError{Field: "staff_id", Message: "must be a UUID"})
+		} else {
+			filter.StaffID = &id
+		}
+	}
+	if patientID := c.Query("patient_id"); patientID != "" {
+		if id, err := uuid.Parse(patientID); err != nil {
+			errs = append(errs, validation.FieldError{Field: "patient_id", Message: "must be a UUID"})
+		} else {
+			filter.PatientID = &id
+		}
+	}
+	for _, bound := range []struct {
+		param string
+		dest  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, validation.FieldError{Field: bound.param, Message: "must be an RFC 3339 timestamp"})
+			continue
+		}
+		*bound.dest = &t
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		seq, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || seq < 1 {
+			errs = append(errs, validation.FieldError{Field: "cursor", Message: "is malformed"})
+		} else {
+			filter.BeforeSeq = seq
+		}
+	}
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		errs.Add("limit", err)
+	}
+	if err := errs.Err(); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid audit trail request", "error", err)
+		respondValidationError(c, err)
+		return
+	}
+
+	events, more, err := h.audit.List(ctx, filter, limit)
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to query audit trail", "error", err, "hospital_id", hospitalID)
+		respondStorageError(c, err, "Failed to fetch audit events")
+		return
+	}
+
+	response := models.AuditEventsResponse{Events: events}
+	if more {
+		response.NextCursor = strconv.FormatInt(events[len(events)-1].Seq, 10)
+	}
+
+	// Reading the audit trail is itself audited.
+	if err := h.recordAudit(ctx, c, auditEntry{action: auditTrailRead, filters: queryFilters(c)}); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit audit trail read", "error", err)
+		respondStorageError(c, err, "Failed to record audit event")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyAuditTrail recomputes the hash chain over the whole audit trail and
+// reports the number of events of the staff member's hospital and the first
+// of them that does not match.
+func (h *Handlers) VerifyAuditTrail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	response, err := h.audit.Verify(ctx, c.GetString("hospital_id"))
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to verify audit trail", "error", err)
+		respondStorageError(c, err, "Failed to verify audit trail")
+		return
+	}
+
+	if !response.Valid {
+		h.log(ctx).ErrorContext(ctx, "Audit trail hash chain is broken", "first_invalid_seq", *response.FirstInvalidSeq)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"agnos_demo/internal/middleware"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestListAuditEvents(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+
+		patientID := uuid.New()
+		events := []*models.AuditEvent{{Seq: 42, Action: auditPatientRead}}
+		m.audit.On("List", mock.Anything, mock.MatchedBy(func(filter repository.AuditFilter) bool {
+			return filter.HospitalID == testHospitalID("hn-001").String() &&
+				filter.PatientID != nil && *filter.PatientID == patientID && filter.StaffID == nil
+		}), 1).Return(events, true, nil)
+
+		// The read of the audit trail is recorded as well
+		m.audit.On("Record", mock.Anything, mock.MatchedBy(func(record repository.AuditRecord) bool {
+			return record.Action == auditTrailRead
+		})).Return(nil).Once()
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/audit?limit=1&patient_id="+patientID.String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionAuditRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.AuditEventsResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Len(t, response.Events, 1)
+		assert.Equal(t, int64(42), response.Events[0].Seq)
+		assert.Equal(t, "42", response.NextCursor)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Invalid Filters", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/audit?staff_id=nope&from=yesterday&cursor=-1", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionAuditRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"staff_id"`)
+		assert.Contains(t, w.Body.String(), `"field":"from"`)
+		assert.Contains(t, w.Body.String(), `"field":"cursor"`)
+		m.audit.AssertNotCalled(t, "List", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Missing Permission", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/audit", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestVerifyAuditTrail(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Valid", func(t *testing.T) {
+		m := newRepos()
+		m.audit.On("Verify", mock.Anything, testHospitalID("hn-001").String()).Return(&models.AuditVerifyResponse{Valid: true, Events: 10}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/audit/verify", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionAuditRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"valid": true, "events": 10}`, w.Body.String())
+	})
+
+	t.Run("Broken Chain", func(t *testing.T) {
+		m := newRepos()
+		invalid := int64(7)
+		m.audit.On("Verify", mock.Anything, testHospitalID("hn-001").String()).Return(&models.AuditVerifyResponse{Events: 10, FirstInvalidSeq: &invalid}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/audit/verify", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionAuditRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"valid": false, "events": 10, "first_invalid_seq": 7}`, w.Body.String())
+	})
+}
+
+func TestPatientReadAuditFailure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	m := newRepos()
+	m.patients.On("GetByNationalID", mock.Anything, mock.Anything, mock.Anything).Return(testPatient(uuid.New(), "hn-001"), nil)
+	m.audit.On("Record", mock.Anything, mock.Anything).Return(errors.New("connection reset"))
+
+	h := m.handlers(logger)
+	r := setupRouter(h)
+
+	req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// The patient must not be returned when the read cannot be audited
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "HN00000001")
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"agnos_demo/internal/middleware"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The tests in this file run the handlers against the in-memory repositories,
+// so they check what requests do rather than which queries they send.
+
+// fuzzyThreshold is the default Search.FuzzyThreshold.
+const fuzzyThreshold = 0.25
+
+// memoryEnv serves the handlers from in-memory repositories that know the
+// hospitals hn-001 and hn-002.
+type memoryEnv struct {
+	router *gin.Engine
+	staff  *repository.MemoryStaffRepository
+	audit  *repository.MemoryAuditRepository
+}
+
+func newMemoryEnv() *memoryEnv {
+	env := &memoryEnv{
+		staff: repository.NewMemoryStaffRepository(
+			models.Hospital{ID: testHospitalID("hn-001"), Code: "hn-001"},
+			models.Hospital{ID: testHospitalID("hn-002"), Code: "hn-002"},
+		),
+		audit: repository.NewMemoryAuditRepository(),
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	env.router = setupRouter(NewHandlers(repository.NewMemoryPatientRepository(fuzzyThreshold), env.staff, env.audit, logger, testFHIRBaseURL))
+	return env
+}
+
+// do sends a request with an optional JSON body and bearer token.
+func (env *memoryEnv) do(method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+// decode unmarshals a response body, failing the test if it is not JSON.
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v), w.Body.String())
+	return v
+}
+
+func TestBehaviorPatientLifecycle(t *testing.T) {
+	env := newMemoryEnv()
+	token := testToken("hn-001", middleware.PermissionPatientRead, middleware.PermissionPatientWrite)
+
+	w := env.do("POST", "/patient", token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	created := decode[models.Patient](t, w)
+	assert.Equal(t, "HN00000001", created.PatientHN)
+
+	w = env.do("GET", "/patient/search?first_name=somc", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	found := decode[models.SearchPatientResponse](t, w)
+	require.Len(t, found.Patient, 1)
+	assert.Equal(t, created.ID, found.Patient[0].ID)
+
+	w = env.do("PATCH", "/patient/"+created.ID.String(), token, `{"phone_number": "081-234-5678"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, models.NullString("+66812345678"), decode[models.Patient](t, w).PhoneNumber)
+
+	w = env.do("GET", "/patient/search/1234567890121", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, models.NullString("+66812345678"), decode[models.Patient](t, w).PhoneNumber)
+
+	w = env.do("DELETE", "/patient/"+created.ID.String(), token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, env.do("GET", "/patient/search/1234567890121", token, "").Code)
+	assert.Equal(t, http.StatusNotFound, env.do("DELETE", "/patient/"+created.ID.String(), token, "").Code)
+	w = env.do("GET", "/patient/search?first_name=somc", token, "")
+	assert.Empty(t, decode[models.SearchPatientResponse](t, w).Patient)
+}
+
+func TestBehaviorHospitalIsolation(t *testing.T) {
+	env := newMemoryEnv()
+	first := testToken("hn-001", middleware.PermissionPatientRead, middleware.PermissionPatientWrite)
+	second := testToken("hn-002", middleware.PermissionPatientRead, middleware.PermissionPatientWrite)
+
+	w := env.do("POST", "/patient", first, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	created := decode[models.Patient](t, w)
+
+	// Another hospital neither finds nor reads the registration
+	w = env.do("GET", "/patient/search?first_name=Somchai", second, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decode[models.SearchPatientResponse](t, w).Patient)
+	assert.Equal(t, http.StatusForbidden, env.do("GET", "/patient/search/1234567890121", second, "").Code)
+	assert.Equal(t, http.StatusNotFound, env.do("GET", "/fhir/Patient/"+created.ID.String(), second, "").Code)
+	assert.Equal(t, http.StatusNotFound, env.do("PATCH", "/patient/"+created.ID.String(), second, `{"phone_number": "0812345678"}`).Code)
+	assert.Equal(t, http.StatusNotFound, env.do("DELETE", "/patient/"+created.ID.String(), second, "").Code)
+
+	// Registering the same person there needs their exact details, and
+	// echoes nothing the other hospital recorded
+	w = env.do("PATCH", "/patient/"+created.ID.String(), first, `{"phone_number": "0812345678"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = env.do("POST", "/patient", second, `{"first_name_en": "Anything", "last_name_en": "Else", "national_id": "1234567890121"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NotContains(t, w.Body.String(), "Somchai")
+
+	w = env.do("POST", "/patient", second, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121", "phone_number": "0899999999"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	registered := decode[models.Patient](t, w)
+	assert.NotEqual(t, created.ID, registered.ID)
+	assert.Equal(t, "HN00000001", registered.PatientHN)
+	assert.Equal(t, models.NullString("+66899999999"), registered.PhoneNumber)
+
+	// Each hospital keeps its own contact details
+	w = env.do("PATCH", "/patient/"+created.ID.String(), first, `{"phone_number": "0811111111"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = env.do("GET", "/patient/search/1234567890121", second, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, registered.ID, decode[models.Patient](t, w).ID)
+	assert.Contains(t, w.Body.String(), `"phone_number":"+66899999999"`)
+
+	// The person's details are shared, so neither hospital can change them
+	w = env.do("PATCH", "/patient/"+created.ID.String(), first, `{"last_name_en": "Rakthai"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "shared with another hospital")
+	w = env.do("GET", "/patient/search/1234567890121", second, "")
+	assert.Contains(t, w.Body.String(), `"last_name_en":"Jaidee"`)
+}
+
+func TestBehaviorDuplicatePatients(t *testing.T) {
+	env := newMemoryEnv()
+	token := testToken("hn-001", middleware.PermissionPatientWrite)
+
+	w := env.do("POST", "/patient", token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121", "passport_id": "AB123456"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = env.do("POST", "/patient", token, `{"first_name_en": "Somsri", "last_name_en": "Rakthai", "national_id": "1111111111119", "passport_id": "ab 123456"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"passport_id"`)
+
+	w = env.do("POST", "/patient", token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121", "passport_id": "AB123456"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "already registered at this hospital")
+
+	w = env.do("POST", "/patient", token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "do not match the person already registered")
+}
+
+func TestBehaviorSearchPages(t *testing.T) {
+	env := newMemoryEnv()
+	token := testToken("hn-001", middleware.PermissionPatientRead, middleware.PermissionPatientWrite)
+
+	names := []string{"Chaiyo", "Areerat", "Ekachai", "Boonmee", "Duangjai"}
+	for i, name := range names {
+		body := fmt.Sprintf(`{"first_name_en": "Test", "last_name_en": %q, "passport_id": "PP%06d"}`, name, i)
+		require.Equal(t, http.StatusCreated, env.do("POST", "/patient", token, body).Code)
+	}
+
+	var seen []string
+	query := url.Values{"sort": {"last_name_en"}, "limit": {"2"}, "include_total": {"true"}}
+	for {
+		w := env.do("GET", "/patient/search?"+query.Encode(), token, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		page := decode[models.SearchPatientResponse](t, w)
+		assert.Equal(t, int64(len(names)), *page.Total)
+		for _, p := range page.Patient {
+			seen = append(seen, string(p.LastNameEN))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	assert.Equal(t, []string{"Areerat", "Boonmee", "Chaiyo", "Duangjai", "Ekachai"}, seen)
+}
+
+func TestBehaviorStaffSession(t *testing.T) {
+	env := newMemoryEnv()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = env.staff.Create(context.Background(), testHospitalID("hn-001").String(), "nurse", string(hash), []string{middleware.RoleClerk})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnauthorized, env.do("POST", "/staff/login", "", `{"username": "nurse", "password": "password123", "hospital": "hn-002"}`).Code)
+
+	w := env.do("POST", "/staff/login", "", `{"username": "nurse", "password": "password123", "hospital": "hn-001"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	login := decode[models.TokenResponse](t, w)
+
+	// The issued token carries the clerk's permissions
+	w = env.do("POST", "/patient", login.Token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusForbidden, env.do("GET", "/audit", login.Token, "").Code)
+
+	w = env.do("POST", "/staff/token/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, login.RefreshToken))
+	require.Equal(t, http.StatusOK, w.Code)
+	refreshed := decode[models.TokenResponse](t, w)
+
+	// Reusing the rotated token ends the session
+	w = env.do("POST", "/staff/token/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, login.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = env.do("POST", "/staff/token/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, refreshed.RefreshToken))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBehaviorAuditTrail(t *testing.T) {
+	env := newMemoryEnv()
+	clerk := testToken("hn-001", middleware.PermissionPatientRead, middleware.PermissionPatientWrite)
+	auditor := testToken("hn-001", middleware.PermissionAuditRead)
+
+	w := env.do("POST", "/patient", clerk, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	created := decode[models.Patient](t, w)
+	require.Equal(t, http.StatusOK, env.do("GET", "/patient/search/1234567890121", clerk, "").Code)
+	require.Equal(t, http.StatusOK, env.do("GET", "/patient/search?first_name=Nobody", clerk, "").Code)
+
+	w = env.do("GET", "/audit?patient_id="+created.ID.String(), auditor, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	events := decode[models.AuditEventsResponse](t, w).Events
+	require.Len(t, events, 2)
+	assert.Equal(t, auditPatientRead, events[0].Action)
+	assert.Equal(t, auditPatientCreate, events[1].Action)
+
+	// Other hospitals do not see the trail
+	w = env.do("GET", "/audit", testToken("hn-002", middleware.PermissionAuditRead), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decode[models.AuditEventsResponse](t, w).Events)
+
+	w = env.do("GET", "/audit/verify", auditor, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, decode[models.AuditVerifyResponse](t, w).Valid)
+}
+
+func TestBehaviorRequestLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	staff := repository.NewMemoryStaffRepository(models.Hospital{ID: testHospitalID("hn-001"), Code: "hn-001"})
+	h := NewHandlers(repository.NewMemoryPatientRepository(fuzzyThreshold), staff, repository.NewMemoryAuditRepository(), logger, testFHIRBaseURL)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.SlogMiddleware(logger))
+	router.GET("/patient/search", middleware.AuthMiddleware(activeTokens()), h.SearchPatient)
+
+	userID := uuid.New().String()
+	token, err := middleware.GenerateToken(userID, testHospitalID("hn-001").String(), "hn-001", []string{}, []string{middleware.PermissionPatientRead})
+	require.NoError(t, err)
+	req, _ := http.NewRequest("GET", "/patient/search?first_name=Nobody", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	lines := map[string]map[string]any{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record), string(line))
+		lines[record["msg"].(string)] = record
+	}
+
+	reqID := w.Header().Get("X-Request-ID")
+	require.NotEmpty(t, reqID)
+	assert.Equal(t, reqID, lines["request received"]["req_id"])
+	assert.NotContains(t, lines["request received"], "user_id")
+	for _, msg := range []string{"Patient search completed", "request processed"} {
+		require.Contains(t, lines, msg)
+		assert.Equal(t, reqID, lines[msg]["req_id"], msg)
+		assert.Equal(t, userID, lines[msg]["user_id"], msg)
+		assert.Equal(t, "hn-001", lines[msg]["hospital"], msg)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"agnos_demo/internal/fhir"
+	"agnos_demo/internal/metrics"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+	"agnos_demo/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const fhirContentType = "application/fhir+json"
+
+// respondFHIR writes a FHIR resource with the FHIR JSON media type.
+func respondFHIR(c *gin.Context, status int, resource interface{}) {
+	c.Header("Content-Type", fhirContentType)
+	c.JSON(status, resource)
+}
+
+// respondFHIRStorageError is respondStorageError for the FHIR endpoints,
+// which report errors as an OperationOutcome.
+func respondFHIRStorageError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		respondFHIR(c, http.StatusGatewayTimeout, fhir.NewOperationOutcome("timeout", "Database query timed out"))
+	case errors.Is(err, context.Canceled):
+		respondFHIR(c, http.StatusServiceUnavailable, fhir.NewOperationOutcome("transient", "Request cancelled"))
+	default:
+		respondFHIR(c, http.StatusInternalServerError, fhir.NewOperationOutcome("exception", message))
+	}
+}
+
+// GetFHIRPatient returns the caller's hospital registration with the given
+// logical id as a FHIR Patient.
+func (h *Handlers) GetFHIRPatient(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID := c.GetString("hospital_id")
+
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondFHIR(c, http.StatusNotFound, fhir.NewOperationOutcome("not-found", "Patient not found"))
+		return
+	}
+
+	p, err := h.patients.GetByID(ctx, hospitalID, patientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondFHIR(c, http.StatusNotFound, fhir.NewOperationOutcome("not-found", "Patient not found"))
+			return
+		}
+		h.log(ctx).ErrorContext(ctx, "Failed to fetch FHIR patient", "error", err, "patient_id", patientID)
+		respondFHIRStorageError(c, err, "Failed to fetch patient")
+		return
+	}
+
+	if err := h.recordAudit(ctx, c, auditEntry{action: auditPatientRead, patientIDs: []uuid.UUID{p.ID}}); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit FHIR patient read", "error", err)
+		respondFHIRStorageError(c, err, "Failed to record audit event")
+		return
+	}
+
+	h.log(ctx).InfoContext(ctx, "FHIR patient retrieved successfully", "patient_id", p.ID, "hospital_id", hospitalID)
+	respondFHIR(c, http.StatusOK, fhir.NewPatient(p))
+}
+
+// SearchFHIRPatients implements the identifier, family, given and birthdate
+// search parameters of the FHIR Patient resource within the caller's hospital.
+// String parameters match case-insensitively from the start of the name, in
+// either language.
+func (h *Handlers) SearchFHIRPatients(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID := c.GetString("hospital_id")
+	filter := repository.PatientFilter{
+		HospitalID: hospitalID,
+		Family:     c.Query("family"),
+		Given:      c.Query("given"),
+	}
+
+	var errs validation.Errors
+	if identifier := c.Query("identifier"); identifier != "" {
+		if err := setFHIRIdentifier(&filter, identifier); err != nil {
+			errs.Add("identifier", err)
+		}
+	}
+	if birthdate := c.Query("birthdate"); birthdate != "" {
+		// Only equality is supported, with or without the eq prefix.
+		date := strings.TrimPrefix(birthdate, "eq")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			errs = append(errs, validation.FieldError{Field: "birthdate", Message: "must be a date in YYYY-MM-DD format"})
+		} else {
+			filter.DateOfBirth = date
+		}
+	}
+	// _count=0 asks for the number of matches alone.
+	count, err := parseLimit(c.Query("_count"))
+	if c.Query("_count") == "0" {
+		count = 0
+	} else if err != nil {
+		errs = append(errs, validation.FieldError{Field: "_count", Message: fmt.Sprintf("must be a number between 0 and %d", maxSearchLimit)})
+	}
+	offset := 0
+	if value := c.Query("_offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			errs = append(errs, validation.FieldError{Field: "_offset", Message: "must be a non-negative number"})
+		}
+	}
+	if err := errs.Err(); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid FHIR patient search request", "error", err)
+		respondFHIR(c, http.StatusBadRequest, fhir.NewOperationOutcome("invalid", err.Error()))
+		return
+	}
+
+	total, err := h.patients.Count(ctx, filter)
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to count FHIR patients", "error", err)
+		respondFHIRStorageError(c, err, "Failed to fetch patients")
+		return
+	}
+
+	patients := []*models.Patient{}
+	if count > 0 {
+		patients, err = h.patients.List(ctx, filter, offset, count)
+		if err != nil {
+			h.log(ctx).ErrorContext(ctx, "Failed to execute FHIR patient search query", "error", err)
+			respondFHIRStorageError(c, err, "Failed to fetch patients")
+			return
+		}
+	}
+
+	patientIDs := make([]uuid.UUID, len(patients))
+	resources := make([]*fhir.Patient, len(patients))
+	for i, p := range patients {
+		patientIDs[i] = p.ID
+		resources[i] = fhir.NewPatient(p)
+	}
+	if err := h.recordAudit(ctx, c, auditEntry{action: auditPatientSearch, patientIDs: patientIDs, filters: queryFilters(c)}); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit FHIR patient search", "error", err)
+		respondFHIRStorageError(c, err, "Failed to record audit event")
+		return
+	}
+
+	baseURL := h.fhirBaseURL + "/Patient"
+	selfURL := baseURL + "?" + c.Request.URL.RawQuery
+	var nextURL string
+	if count > 0 && int64(offset+len(patients)) < total {
+		next := c.Request.URL.Query()
+		next.Set("_offset", strconv.Itoa(offset+len(patients)))
+		nextURL = baseURL + "?" + next.Encode()
+	}
+
+	metrics.PatientSearchResults.WithLabelValues("fhir").Observe(float64(len(patients)))
+	h.log(ctx).InfoContext(ctx, "FHIR patient search completed", "hospital_id", hospitalID, "results_count", len(patients), "total", total)
+	respondFHIR(c, http.StatusOK, fhir.NewSearchBundle(baseURL, selfURL, nextURL, total, resources))
+}
+
+// setFHIRIdentifier filters by an identifier search value, "system|value" or
+// a bare value, after normalizing it. A bare 13-digit value is a national ID,
+// anything else a passport number.
+func setFHIRIdentifier(filter *repository.PatientFilter, identifier string) error {
+	system, value, found := strings.Cut(identifier, "|")
+	if !found {
+		system, value = "", identifier
+	}
+
+	switch {
+	case system == fhir.NationalIDSystem || (system == "" && validation.IsNationalIDShaped(value)):
+		if err := validation.ValidateThaiNationalID(value); err != nil {
+			return err
+		}
+		filter.NationalID = value
+		return nil
+	case system == fhir.PassportSystem || system == "":
+		normalized, err := validation.NormalizePassport(value)
+		if err != nil {
+			return err
+		}
+		filter.PassportID = normalized
+		return nil
+	case system == fhir.HospitalNumberSystem(filter.HospitalID):
+		filter.PatientHN = value
+		return nil
+	}
+	return fmt.Errorf("system %q is not supported", system)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"agnos_demo/internal/fhir"
+	"agnos_demo/internal/middleware"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFHIRPatient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		testID := uuid.New()
+		m.patients.On("GetByID", mock.Anything, testHospitalID("hn-001").String(), testID).Return(testPatient(testID, "hn-001"), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient/"+testID.String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/fhir+json", w.Header().Get("Content-Type"))
+
+		var patient fhir.Patient
+		json.Unmarshal(w.Body.Bytes(), &patient)
+		assert.Equal(t, "Patient", patient.ResourceType)
+		assert.Equal(t, testID.String(), patient.ID)
+		assert.Equal(t, "HN00000001", patient.Identifier[0].Value)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("GetByID", mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `"resourceType":"OperationOutcome"`)
+		assert.Contains(t, w.Body.String(), `"code":"not-found"`)
+	})
+
+	t.Run("Query Timeout", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("GetByID", mock.Anything, mock.Anything, mock.Anything).Return(nil, context.DeadlineExceeded)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"timeout"`)
+	})
+
+	t.Run("Malformed ID", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient/1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		m.patients.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestSearchFHIRPatients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		filter := repository.PatientFilter{
+			HospitalID:  testHospitalID("hn-001").String(),
+			NationalID:  "1234567890121",
+			Family:      "Do",
+			DateOfBirth: "1980-01-01",
+		}
+		m.patients.On("Count", mock.Anything, filter).Return(int64(3), nil)
+		m.patients.On("List", mock.Anything, filter, 0, 1).Return([]*models.Patient{testPatient(uuid.New(), "hn-001")}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		query := "identifier=" + fhir.NationalIDSystem + "|1234567890121&family=Do&birthdate=eq1980-01-01&_count=1"
+		req, _ := http.NewRequest("GET", "/fhir/Patient?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		// Links come from the configured base URL, never from the request
+		req.Host = "evil.example.com"
+		req.Header.Set("X-Forwarded-Proto", "javascript")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/fhir+json", w.Header().Get("Content-Type"))
+		assert.NotContains(t, w.Body.String(), "evil.example.com")
+		assert.NotContains(t, w.Body.String(), "javascript")
+
+		var bundle fhir.Bundle
+		json.Unmarshal(w.Body.Bytes(), &bundle)
+		assert.Equal(t, "searchset", bundle.Type)
+		assert.Equal(t, int64(3), bundle.Total)
+		assert.Len(t, bundle.Entry, 1)
+		assert.Len(t, bundle.Link, 2)
+		assert.Equal(t, "next", bundle.Link[1].Relation)
+		assert.Contains(t, bundle.Link[1].URL, "_offset=1")
+		assert.Equal(t, testFHIRBaseURL+"/Patient?"+query, bundle.Link[0].URL)
+		assert.True(t, strings.HasPrefix(bundle.Entry[0].FullURL, testFHIRBaseURL+"/Patient/"), bundle.Entry[0].FullURL)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Count Only", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		filter := repository.PatientFilter{HospitalID: testHospitalID("hn-001").String(), Family: "Do"}
+		m.patients.On("Count", mock.Anything, filter).Return(int64(3), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient?family=Do&_count=0", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var bundle fhir.Bundle
+		json.Unmarshal(w.Body.Bytes(), &bundle)
+		assert.Equal(t, int64(3), bundle.Total)
+		assert.Empty(t, bundle.Entry)
+		require.Len(t, bundle.Link, 1)
+		assert.Equal(t, "self", bundle.Link[0].Relation)
+		m.patients.AssertNotCalled(t, "List", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Unsupported Parameters", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient?birthdate=gt1980-01-01&identifier=urn:other|123", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid"`)
+		assert.Contains(t, w.Body.String(), "birthdate")
+		assert.Contains(t, w.Body.String(), "identifier")
+	})
+
+	t.Run("Missing Permission", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("GET", "/fhir/Patient", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionAuditRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
-	"agnos_demo/internal/database"
+	"agnos_demo/internal/logging"
+	"agnos_demo/internal/metrics"
 	"agnos_demo/internal/middleware"
 	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+	"agnos_demo/internal/validation"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,343 +23,595 @@ import (
 )
 
 type Handlers struct {
-	db     database.DB
-	logger *slog.Logger
+	patients repository.PatientRepository
+	staff    repository.StaffRepository
+	audit    repository.AuditRepository
+	logger   *slog.Logger
+
+	// fhirBaseURL is the absolute URL of the FHIR endpoints as published,
+	// which the links of FHIR bundles are built from.
+	fhirBaseURL string
 }
 
-func NewHandlers(db database.DB, logger *slog.Logger) *Handlers {
+func NewHandlers(patients repository.PatientRepository, staff repository.StaffRepository, audit repository.AuditRepository, logger *slog.Logger, fhirBaseURL string) *Handlers {
 	return &Handlers{
-		db:     db,
-		logger: logger,
+		patients:    patients,
+		staff:       staff,
+		audit:       audit,
+		logger:      logger,
+		fhirBaseURL: strings.TrimSuffix(fhirBaseURL, "/"),
 	}
 }
 
+// log returns the logger of the request ctx belongs to, which carries its
+// req_id and, once authenticated, the staff member and hospital.
+func (h *Handlers) log(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx, h.logger)
+}
+
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "OK"})
 }
 
 func (h *Handlers) CreateStaff(c *gin.Context) {
+	ctx := c.Request.Context()
 	var input models.CreateStaffRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.logger.Warn("Invalid staff creation request", "error", err)
+		h.log(ctx).WarnContext(ctx, "Invalid staff creation request", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	h.logger.Debug("Creating staff", "username", input.Username, "hospital", input.Hospital)
+	if input.Hospital != c.GetString("hospital") {
+		h.log(ctx).WarnContext(ctx, "Staff creation denied - different hospital", "staff_hospital", input.Hospital)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot create staff for a different hospital"})
+		return
+	}
+
+	if len(input.Roles) == 0 {
+		input.Roles = []string{middleware.RoleClerk}
+	}
+
+	h.log(ctx).DebugContext(ctx, "Creating staff", logging.Username("username", input.Username), "staff_hospital", input.Hospital, "roles", input.Roles)
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		h.logger.Error("Failed to hash password", "error", err)
+		h.log(ctx).ErrorContext(ctx, "Failed to hash password", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	ctx := context.Background()
-	var staffID uuid.UUID
-
-	query := `
-		INSERT INTO staff (username, password_hash, hospital)
-		VALUES ($1, $2, $3)
-		RETURNING id
-	`
-
-	err = h.db.QueryRow(ctx, query, input.Username, string(hashedPassword), input.Hospital).Scan(&staffID)
+	staffID, err := h.staff.Create(ctx, c.GetString("hospital_id"), input.Username, string(hashedPassword), input.Roles)
 	if err != nil {
-		h.logger.Error("Failed to create staff in database", "error", err, "username", input.Username)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create staff"})
+		h.log(ctx).ErrorContext(ctx, "Failed to create staff in database", "error", err, logging.Username("username", input.Username))
+		respondStorageError(c, err, "Failed to create staff")
 		return
 	}
 
-	h.logger.Info("Staff created successfully", "staff_id", staffID, "username", input.Username, "hospital", input.Hospital)
+	h.log(ctx).InfoContext(ctx, "Staff created successfully", "staff_id", staffID, logging.Username("username", input.Username), "staff_hospital", input.Hospital, "roles", input.Roles)
+	h.auditWrite(ctx, c, auditEntry{action: auditStaffCreate, targetStaffID: &staffID})
 	c.JSON(http.StatusCreated, gin.H{"message": "Staff created successfully", "id": staffID})
 }
 
 func (h *Handlers) LoginStaff(c *gin.Context) {
+	ctx := c.Request.Context()
 	var input models.LoginRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.logger.Warn("Invalid login request", "error", err)
+		h.log(ctx).WarnContext(ctx, "Invalid login request", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	h.logger.Debug("Login attempt", "username", input.Username, "hospital", input.Hospital)
-
-	ctx := context.Background()
-	var staff models.Staff
-
-	query := `
-		SELECT id, username, password_hash, hospital
-		FROM staff
-		WHERE username = $1 AND hospital = $2
-	`
+	h.log(ctx).DebugContext(ctx, "Login attempt", logging.Username("username", input.Username), "hospital", input.Hospital)
 
-	err := h.db.QueryRow(ctx, query, input.Username, input.Hospital).Scan(
-		&staff.ID,
-		&staff.Username,
-		&staff.PasswordHash,
-		&staff.Hospital,
-	)
+	staff, err := h.staff.GetActive(ctx, input.Username, input.Hospital)
 	if err != nil {
-		h.logger.Warn("Login failed - user not found", "username", input.Username, "hospital", input.Hospital, "error", err)
+		h.log(ctx).WarnContext(ctx, "Login failed - user not found", logging.Username("username", input.Username), "hospital", input.Hospital, "error", err)
+		metrics.LoginAttempts.WithLabelValues(metrics.UnknownHospital, metrics.LoginFailure).Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(staff.PasswordHash), []byte(input.Password)); err != nil {
-		h.logger.Warn("Login failed - invalid password", "username", input.Username, "hospital", input.Hospital)
+		h.log(ctx).WarnContext(ctx, "Login failed - invalid password", logging.Username("username", input.Username), "hospital", input.Hospital)
+		metrics.LoginAttempts.WithLabelValues(staff.Hospital, metrics.LoginFailure).Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := middleware.GenerateToken(staff.ID.String(), staff.Hospital)
+	hospital := models.Hospital{ID: staff.HospitalID, Code: staff.Hospital}
+	resp, err := h.issueTokens(ctx, staff.ID, hospital, uuid.New())
 	if err != nil {
-		h.logger.Error("Failed to generate token", "error", err, "staff_id", staff.ID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		h.log(ctx).ErrorContext(ctx, "Failed to generate token", "error", err, "staff_id", staff.ID)
+		respondStorageError(c, err, "Failed to generate token")
 		return
 	}
 
-	h.logger.Info("Login successful", "staff_id", staff.ID, "username", input.Username, "hospital", input.Hospital)
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	h.log(ctx).InfoContext(ctx, "Login successful", "staff_id", staff.ID, logging.Username("username", input.Username), "hospital", input.Hospital)
+	metrics.LoginAttempts.WithLabelValues(staff.Hospital, metrics.LoginSuccess).Inc()
+	h.auditWrite(ctx, c, auditEntry{action: auditStaffLogin, staffID: staff.ID.String(), hospitalID: staff.HospitalID.String()})
+	c.JSON(http.StatusOK, resp)
 }
 
-func (h *Handlers) SearchPatient(c *gin.Context) {
-	hospital, exists := c.Get("hospital")
-	if !exists {
-		h.logger.Warn("Unauthorized patient search attempt - no hospital in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+// issueTokens signs a new access token and stores a new refresh token in the
+// given session family.
+func (h *Handlers) issueTokens(ctx context.Context, staffID uuid.UUID, hospital models.Hospital, familyID uuid.UUID) (*models.TokenResponse, error) {
+	roles, permissions, err := h.staff.Access(ctx, staffID)
+	if err != nil {
+		return nil, err
 	}
 
-	h.logger.Debug("Patient search request", "hospital", hospital, "query_params", c.Request.URL.RawQuery)
+	token, err := middleware.GenerateToken(staffID.String(), hospital.ID.String(), hospital.Code, roles, permissions)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx := context.Background()
+	refreshToken, refreshHash, err := middleware.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
 
-	var conditions []string
-	var args []interface{}
-	argIndex := 1
+	if err := h.staff.StoreRefreshToken(ctx, staffID, familyID, refreshHash, time.Now().Add(middleware.RefreshTokenTTL())); err != nil {
+		return nil, err
+	}
 
-	hospitalFilter := hospital.(string)
-	conditions = append(conditions, fmt.Sprintf("patient_hn LIKE $%d", argIndex))
-	args = append(args, hospitalFilter+"%")
-	argIndex++
+	return &models.TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(middleware.AccessTokenTTL().Seconds()),
+	}, nil
+}
 
-	if patientHN := c.Query("patient_hn"); patientHN != "" {
-		conditions = append(conditions, fmt.Sprintf("patient_hn = $%d", argIndex))
-		args = append(args, patientHN)
-		argIndex++
+func (h *Handlers) RefreshToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid token refresh request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if nationalID := c.Query("national_id"); nationalID != "" {
-		conditions = append(conditions, fmt.Sprintf("national_id = $%d", argIndex))
-		args = append(args, nationalID)
-		argIndex++
+
+	tokenHash := middleware.HashRefreshToken(input.RefreshToken)
+
+	// Rotate: the presented token is revoked as it is validated, so it can
+	// only ever be exchanged once.
+	session, err := h.staff.RotateRefreshToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			h.revokeReusedRefreshToken(ctx, tokenHash)
+		}
+		h.log(ctx).WarnContext(ctx, "Token refresh failed", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
 	}
-	if passportID := c.Query("passport_id"); passportID != "" {
-		conditions = append(conditions, fmt.Sprintf("passport_id = $%d", argIndex))
-		args = append(args, passportID)
-		argIndex++
+
+	resp, err := h.issueTokens(ctx, session.StaffID, session.Hospital, session.FamilyID)
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to generate token", "error", err, "staff_id", session.StaffID)
+		respondStorageError(c, err, "Failed to generate token")
+		return
 	}
-	if firstName := c.Query("first_name"); firstName != "" {
-		conditions = append(conditions, fmt.Sprintf("(LOWER(first_name_en) LIKE LOWER($%d) OR LOWER(first_name_th) LIKE LOWER($%d))", argIndex, argIndex))
-		args = append(args, "%"+firstName+"%")
-		argIndex++
+
+	h.log(ctx).InfoContext(ctx, "Token refreshed", "staff_id", session.StaffID, "hospital", session.Hospital.Code)
+	c.JSON(http.StatusOK, resp)
+}
+
+// revokeReusedRefreshToken revokes the whole session when an already rotated
+// refresh token is presented again, since that means it has leaked.
+func (h *Handlers) revokeReusedRefreshToken(ctx context.Context, tokenHash string) {
+	revoked, err := h.staff.RevokeReusedRefreshToken(ctx, tokenHash)
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to revoke reused refresh token family", "error", err)
+		return
 	}
-	if middleName := c.Query("middle_name"); middleName != "" {
-		conditions = append(conditions, fmt.Sprintf("(LOWER(middle_name_en) LIKE LOWER($%d) OR LOWER(middle_name_th) LIKE LOWER($%d))", argIndex, argIndex))
-		args = append(args, "%"+middleName+"%")
-		argIndex++
+	if revoked > 0 {
+		h.log(ctx).WarnContext(ctx, "Refresh token reuse detected - session revoked", "revoked_tokens", revoked)
 	}
-	if lastName := c.Query("last_name"); lastName != "" {
-		conditions = append(conditions, fmt.Sprintf("(LOWER(last_name_en) LIKE LOWER($%d) OR LOWER(last_name_th) LIKE LOWER($%d))", argIndex, argIndex))
-		args = append(args, "%"+lastName+"%")
-		argIndex++
+}
+
+func (h *Handlers) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input models.LogoutRequest
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		h.log(ctx).WarnContext(ctx, "Invalid logout request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if dob := c.Query("date_of_birth"); dob != "" {
-		conditions = append(conditions, fmt.Sprintf("date_of_birth = $%d", argIndex))
-		args = append(args, dob)
-		argIndex++
+
+	userID := c.GetString("user_id")
+	jti := c.GetString("jti")
+	expiresAt := c.GetTime("token_expires_at")
+
+	if err := h.staff.RevokeAccessToken(ctx, jti, userID, expiresAt); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to revoke access token", "error", err, "staff_id", userID)
+		respondStorageError(c, err, "Failed to logout")
+		return
+	}
+
+	if input.RefreshToken != "" {
+		if err := h.staff.RevokeSession(ctx, userID, middleware.HashRefreshToken(input.RefreshToken)); err != nil {
+			h.log(ctx).ErrorContext(ctx, "Failed to revoke refresh token", "error", err, "staff_id", userID)
+			respondStorageError(c, err, "Failed to logout")
+			return
+		}
 	}
 
-	query := fmt.Sprintf(
-		`SELECT id, patient_hn, first_name_th, middle_name_th, last_name_th, first_name_en, middle_name_en, last_name_en, 
-		 date_of_birth, gender, national_id, passport_id, phone_number, email 
-		 FROM patients WHERE %s`,
-		strings.Join(conditions, " AND "),
-	)
+	h.log(ctx).InfoContext(ctx, "Logout successful", "staff_id", userID)
+	h.auditWrite(ctx, c, auditEntry{action: auditStaffLogout})
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
 
-	h.logger.Debug("Executing patient search query", "hospital", hospital, "conditions_count", len(conditions))
+func (h *Handlers) DeactivateStaff(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID := c.GetString("hospital_id")
 
-	rows, err := h.db.Query(ctx, query, args...)
+	staffID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		h.logger.Error("Failed to execute patient search query", "error", err, "hospital", hospital)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patients"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff id"})
 		return
 	}
-	defer rows.Close()
 
-	var patients []*models.Patient
-	for rows.Next() {
-		var p models.Patient
-		var (
-			firstNameTH, middleNameTH, lastNameTH              *string
-			firstNameEN, middleNameEN, lastNameEN              *string
-			gender, nationalID, passportID, phoneNumber, email *string
-			dateOfBirth                                        *models.Date
-		)
+	if staffID.String() == c.GetString("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot deactivate your own account"})
+		return
+	}
 
-		err := rows.Scan(
-			&p.ID, &p.PatientHN,
-			&firstNameTH, &middleNameTH, &lastNameTH,
-			&firstNameEN, &middleNameEN, &lastNameEN,
-			&dateOfBirth, &gender,
-			&nationalID, &passportID, &phoneNumber, &email,
-		)
-		if err != nil {
-			h.logger.Error("Failed to scan patient row", "error", err)
-			continue
+	// Existing access tokens are rejected by AuthMiddleware once the staff
+	// member is inactive; outstanding refresh tokens are revoked as well.
+	if err := h.staff.Deactivate(ctx, hospitalID, staffID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Active staff not found"})
+			return
 		}
+		h.log(ctx).ErrorContext(ctx, "Failed to deactivate staff", "error", err, "staff_id", staffID)
+		respondStorageError(c, err, "Failed to deactivate staff")
+		return
+	}
 
-		if firstNameTH != nil {
-			p.FirstNameTH = *firstNameTH
-		}
-		if middleNameTH != nil {
-			p.MiddleNameTH = *middleNameTH
-		}
-		if lastNameTH != nil {
-			p.LastNameTH = *lastNameTH
-		}
-		if firstNameEN != nil {
-			p.FirstNameEN = *firstNameEN
-		}
-		if middleNameEN != nil {
-			p.MiddleNameEN = *middleNameEN
-		}
-		if lastNameEN != nil {
-			p.LastNameEN = *lastNameEN
-		}
-		if dateOfBirth != nil {
-			p.DateOfBirth = dateOfBirth
-		}
-		if gender != nil {
-			p.Gender = *gender
-		}
-		if nationalID != nil {
-			p.NationalID = *nationalID
-		}
-		if passportID != nil {
-			p.PassportID = *passportID
-		}
-		if phoneNumber != nil {
-			p.PhoneNumber = *phoneNumber
+	h.log(ctx).InfoContext(ctx, "Staff deactivated", "staff_id", staffID)
+	h.auditWrite(ctx, c, auditEntry{action: auditStaffDeactivate, targetStaffID: &staffID})
+	c.JSON(http.StatusOK, gin.H{"message": "Staff deactivated successfully", "id": staffID})
+}
+
+func (h *Handlers) SearchPatient(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID, exists := c.Get("hospital_id")
+	if !exists {
+		h.log(ctx).WarnContext(ctx, "Unauthorized patient search attempt - no hospital in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	h.log(ctx).DebugContext(ctx, "Patient search request", logging.Query("query_params", c.Request.URL.Query()))
+
+	var errs validation.Errors
+	filter := repository.PatientFilter{
+		HospitalID:  hospitalID.(string),
+		PatientHN:   c.Query("patient_hn"),
+		NationalID:  c.Query("national_id"),
+		PassportID:  c.Query("passport_id"),
+		DateOfBirth: c.Query("date_of_birth"),
+		FirstName:   c.Query("first_name"),
+		MiddleName:  c.Query("middle_name"),
+		LastName:    c.Query("last_name"),
+	}
+	if err := validation.NormalizePatient(&filter.NationalID, &filter.PassportID, nil); err != nil {
+		errs = append(errs, err.(validation.Errors)...)
+	}
+	if filter.DateOfBirth != "" {
+		if _, err := time.Parse("2006-01-02", filter.DateOfBirth); err != nil {
+			errs = append(errs, validation.FieldError{Field: "date_of_birth", Message: "must be a date in YYYY-MM-DD format"})
 		}
-		if email != nil {
-			p.Email = *email
+	}
+	match := c.DefaultQuery("match", "contains")
+	if match != "contains" && match != "fuzzy" {
+		errs = append(errs, validation.FieldError{Field: "match", Message: "must be contains or fuzzy"})
+	}
+	filter.Fuzzy = match == "fuzzy"
+	if filter.Fuzzy && filter.FirstName == "" && filter.MiddleName == "" && filter.LastName == "" {
+		errs = append(errs, validation.FieldError{Field: "match", Message: "fuzzy requires first_name, middle_name or last_name"})
+	}
+	limit, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		errs.Add("limit", err)
+	}
+	sortParam, sortKey, descending, err := parseSort(c.Query("sort"), filter.Fuzzy)
+	if err != nil {
+		errs.Add("sort", err)
+	}
+	var cursor *searchCursor
+	if encoded := c.Query("cursor"); encoded != "" && sortParam != "" {
+		if cursor, err = decodeCursor(encoded, sortParam); err != nil {
+			errs.Add("cursor", err)
 		}
+	}
+	if err := errs.Err(); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid patient search request", "error", err)
+		respondValidationError(c, err)
+		return
+	}
 
-		patients = append(patients, &p)
+	search := repository.PatientSearch{Filter: filter, Sort: sortKey, Descending: descending, Limit: limit}
+	if cursor != nil {
+		search.After = &repository.PatientCursor{Value: cursor.Value, ID: cursor.ID}
 	}
 
-	if err := rows.Err(); err != nil {
-		h.logger.Error("Error reading patient rows", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading patients"})
+	h.log(ctx).DebugContext(ctx, "Executing patient search query", "match", match, "sort", sortParam, "limit", limit)
+
+	page, err := h.patients.Search(ctx, search)
+	if err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to search patients", "error", err)
+		respondStorageError(c, err, "Failed to fetch patients")
 		return
 	}
 
-	h.logger.Info("Patient search completed", "hospital", hospital, "results_count", len(patients))
-	c.JSON(http.StatusOK, models.SearchPatientResponse{
-		Patient: patients,
-	})
+	response := models.SearchPatientResponse{Patient: page.Patients}
+	if page.Next != nil {
+		response.NextCursor = encodeCursor(searchCursor{Sort: sortParam, Value: page.Next.Value, ID: page.Next.ID})
+	}
+
+	// The total ignores the cursor so it stays the same on every page.
+	if c.Query("include_total") == "true" {
+		total, err := h.patients.Count(ctx, filter)
+		if err != nil {
+			h.log(ctx).ErrorContext(ctx, "Failed to count patients", "error", err)
+			respondStorageError(c, err, "Failed to count patients")
+			return
+		}
+		response.Total = &total
+	}
+
+	patientIDs := make([]uuid.UUID, len(page.Patients))
+	for i, p := range page.Patients {
+		patientIDs[i] = p.ID
+	}
+	if err := h.recordAudit(ctx, c, auditEntry{action: auditPatientSearch, patientIDs: patientIDs, filters: queryFilters(c)}); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit patient search", "error", err)
+		respondStorageError(c, err, "Failed to record audit event")
+		return
+	}
+
+	metrics.PatientSearchResults.WithLabelValues("rest").Observe(float64(len(page.Patients)))
+	h.log(ctx).InfoContext(ctx, "Patient search completed", "results_count", len(page.Patients), "has_more", response.NextCursor != "")
+	c.JSON(http.StatusOK, response)
+}
+
+// identifierAttr logs a patient identifier from a request path, as a national
+// ID if it is shaped like one and as a passport number otherwise.
+func identifierAttr(identifier string) slog.Attr {
+	if validation.IsNationalIDShaped(identifier) {
+		return logging.NationalID("identifier", identifier)
+	}
+	return logging.Passport("identifier", identifier)
 }
 
 func (h *Handlers) GetPatientByID(c *gin.Context) {
-	hospital, exists := c.Get("hospital")
+	ctx := c.Request.Context()
+	hospitalID, exists := c.Get("hospital_id")
 	if !exists {
-		h.logger.Warn("Unauthorized patient retrieval attempt - no hospital in context")
+		h.log(ctx).WarnContext(ctx, "Unauthorized patient retrieval attempt - no hospital in context")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	identifier := c.Param("id")
-	h.logger.Debug("Get patient by identifier request", "identifier", identifier, "hospital", hospital)
-
-	ctx := context.Background()
-
-	// Query patient and verify hospital matches
-	query := `
-		SELECT id, patient_hn, first_name_th, middle_name_th, last_name_th, first_name_en, middle_name_en, last_name_en, 
-		 date_of_birth, gender, national_id, passport_id, phone_number, email 
-		FROM patients 
-		WHERE national_id = $1 OR passport_id = $1
-	`
-
-	var p models.Patient
-	var (
-		firstNameTH, middleNameTH, lastNameTH              *string
-		firstNameEN, middleNameEN, lastNameEN              *string
-		gender, nationalID, passportID, phoneNumber, email *string
-		dateOfBirth                                        *models.Date
-	)
-
-	err := h.db.QueryRow(ctx, query, identifier).Scan(
-		&p.ID, &p.PatientHN,
-		&firstNameTH, &middleNameTH, &lastNameTH,
-		&firstNameEN, &middleNameEN, &lastNameEN,
-		&dateOfBirth, &gender,
-		&nationalID, &passportID, &phoneNumber, &email,
-	)
+	h.log(ctx).DebugContext(ctx, "Get patient by identifier request", identifierAttr(identifier))
+
+	// A 13-digit identifier is a national ID, anything else a passport number.
+	nationalID := validation.IsNationalIDShaped(identifier)
+	var err error
+	if nationalID {
+		err = validation.NormalizePatient(&identifier, nil, nil)
+	} else {
+		err = validation.NormalizePatient(nil, &identifier, nil)
+	}
 	if err != nil {
-		h.logger.Warn("Patient not found", "identifier", identifier, "error", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		h.log(ctx).WarnContext(ctx, "Invalid patient identifier", identifierAttr(identifier), "error", err)
+		respondValidationError(c, err)
 		return
 	}
 
-	if firstNameTH != nil {
-		p.FirstNameTH = *firstNameTH
+	// A person may be registered at several hospitals; a registration at
+	// another hospital tells that case apart from an unknown identifier.
+	var p *models.Patient
+	if nationalID {
+		p, err = h.patients.GetByNationalID(ctx, hospitalID.(string), identifier)
+	} else {
+		p, err = h.patients.GetByPassportID(ctx, hospitalID.(string), identifier)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			h.log(ctx).WarnContext(ctx, "Patient not found", identifierAttr(identifier))
+			c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+			return
+		}
+		h.log(ctx).ErrorContext(ctx, "Failed to fetch patient", "error", err, identifierAttr(identifier))
+		respondStorageError(c, err, "Failed to fetch patient")
+		return
 	}
-	if middleNameTH != nil {
-		p.MiddleNameTH = *middleNameTH
+
+	if p.HospitalID.String() != hospitalID.(string) {
+		h.log(ctx).WarnContext(ctx, "Access denied - patient belongs to different hospital",
+			identifierAttr(identifier),
+			"patient_hospital_id", p.HospitalID,
+			"staff_hospital_id", hospitalID,
+		)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied - patient belongs to different hospital"})
+		return
 	}
-	if lastNameTH != nil {
-		p.LastNameTH = *lastNameTH
+
+	if err := h.recordAudit(ctx, c, auditEntry{action: auditPatientRead, patientIDs: []uuid.UUID{p.ID}}); err != nil {
+		h.log(ctx).ErrorContext(ctx, "Failed to audit patient retrieval", "error", err)
+		respondStorageError(c, err, "Failed to record audit event")
+		return
 	}
-	if firstNameEN != nil {
-		p.FirstNameEN = *firstNameEN
+
+	h.log(ctx).InfoContext(ctx, "Patient retrieved successfully", identifierAttr(identifier))
+	c.JSON(http.StatusOK, p)
+}
+
+func (h *Handlers) CreatePatient(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID, exists := c.Get("hospital_id")
+	if !exists {
+		h.log(ctx).WarnContext(ctx, "Unauthorized patient creation attempt - no hospital in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
-	if middleNameEN != nil {
-		p.MiddleNameEN = *middleNameEN
+
+	var input models.CreatePatientRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid patient creation request", "error", err)
+		respondValidationError(c, bindingErrors(err))
+		return
 	}
-	if lastNameEN != nil {
-		p.LastNameEN = *lastNameEN
+	if err := validation.NormalizePatient(&input.NationalID, &input.PassportID, &input.PhoneNumber); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid patient creation request", "error", err)
+		respondValidationError(c, err)
+		return
 	}
-	if dateOfBirth != nil {
-		p.DateOfBirth = dateOfBirth
+
+	// The registration is linked to the person already known under the
+	// national ID (or, without one, the passport) if the details match, and a
+	// new person is only created otherwise.
+	p, err := h.patients.Create(ctx, hospitalID.(string), &input)
+	if err != nil {
+		if h.respondPatientWriteError(c, err) {
+			return
+		}
+		h.log(ctx).ErrorContext(ctx, "Failed to create patient", "error", err, "hospital_id", hospitalID)
+		respondStorageError(c, err, "Failed to create patient")
+		return
 	}
-	if gender != nil {
-		p.Gender = *gender
+
+	h.log(ctx).InfoContext(ctx, "Patient created successfully", "patient_id", p.ID, "patient_hn", p.PatientHN, "hospital_id", hospitalID)
+	h.auditWrite(ctx, c, auditEntry{action: auditPatientCreate, patientIDs: []uuid.UUID{p.ID}})
+	c.JSON(http.StatusCreated, p)
+}
+
+func (h *Handlers) UpdatePatient(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID, exists := c.Get("hospital_id")
+	if !exists {
+		h.log(ctx).WarnContext(ctx, "Unauthorized patient update attempt - no hospital in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
-	if nationalID != nil {
-		p.NationalID = *nationalID
+
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient id"})
+		return
 	}
-	if passportID != nil {
-		p.PassportID = *passportID
+
+	var input models.UpdatePatientRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid patient update request", "error", err)
+		respondValidationError(c, bindingErrors(err))
+		return
 	}
-	if phoneNumber != nil {
-		p.PhoneNumber = *phoneNumber
+	if err := validation.NormalizePatient(input.NationalID, input.PassportID, input.PhoneNumber); err != nil {
+		h.log(ctx).WarnContext(ctx, "Invalid patient update request", "error", err)
+		respondValidationError(c, err)
+		return
 	}
-	if email != nil {
-		p.Email = *email
+
+	if input.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
 	}
 
-	if p.PatientHN != hospital.(string) {
-		h.logger.Warn("Access denied - patient belongs to different hospital",
-			"identifier", identifier,
-			"patient_hospital", p.PatientHN,
-			"staff_hospital", hospital,
-		)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied - patient belongs to different hospital"})
+	// Contact details are the registration's; the other details belong to
+	// the person and are refused while another hospital shares them.
+	p, err := h.patients.Update(ctx, hospitalID.(string), patientID, &input)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+			return
+		}
+		if h.respondPatientWriteError(c, err) {
+			return
+		}
+		h.log(ctx).ErrorContext(ctx, "Failed to update patient", "error", err, "patient_id", patientID, "hospital_id", hospitalID)
+		respondStorageError(c, err, "Failed to update patient")
 		return
 	}
 
-	h.logger.Info("Patient retrieved successfully", "identifier", identifier, "hospital", hospital)
+	h.log(ctx).InfoContext(ctx, "Patient updated successfully", "patient_id", p.ID, "hospital_id", hospitalID)
+	h.auditWrite(ctx, c, auditEntry{action: auditPatientUpdate, patientIDs: []uuid.UUID{p.ID}})
 	c.JSON(http.StatusOK, p)
 }
+
+func (h *Handlers) DeletePatient(c *gin.Context) {
+	ctx := c.Request.Context()
+	hospitalID, exists := c.Get("hospital_id")
+	if !exists {
+		h.log(ctx).WarnContext(ctx, "Unauthorized patient deletion attempt - no hospital in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	patientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient id"})
+		return
+	}
+
+	if err := h.patients.Delete(ctx, hospitalID.(string), patientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+			return
+		}
+		h.log(ctx).ErrorContext(ctx, "Failed to delete patient", "error", err, "patient_id", patientID, "hospital_id", hospitalID)
+		respondStorageError(c, err, "Failed to delete patient")
+		return
+	}
+
+	h.log(ctx).InfoContext(ctx, "Patient deleted successfully", "patient_id", patientID, "hospital_id", hospitalID)
+	h.auditWrite(ctx, c, auditEntry{action: auditPatientDelete, patientIDs: []uuid.UUID{patientID}})
+	c.JSON(http.StatusOK, gin.H{"message": "Patient deleted successfully", "id": patientID})
+}
+
+// respondPatientWriteError writes a 409 for conflicting patient details and a
+// 400 for a patient left without an identifier. It reports whether a response
+// was written.
+func (h *Handlers) respondPatientWriteError(c *gin.Context, err error) bool {
+	ctx := c.Request.Context()
+	var duplicate *repository.DuplicateError
+	switch {
+	case errors.As(err, &duplicate):
+		h.log(ctx).WarnContext(ctx, "Patient write conflict", "field", duplicate.Field)
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Patient with this %s already exists", duplicate.Field), "field": duplicate.Field})
+		return true
+	case errors.Is(err, repository.ErrAlreadyRegistered):
+		h.log(ctx).WarnContext(ctx, "Patient write conflict", "error", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Patient is already registered at this hospital"})
+		return true
+	case errors.Is(err, repository.ErrPersonMismatch):
+		h.log(ctx).WarnContext(ctx, "Patient write conflict", "error", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Patient details do not match the person already registered with this national_id or passport_id"})
+		return true
+	case errors.Is(err, repository.ErrSharedPerson):
+		h.log(ctx).WarnContext(ctx, "Patient write conflict", "error", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Patient details are shared with another hospital; only phone_number and email can be changed"})
+		return true
+	case errors.Is(err, repository.ErrIdentifierRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either national_id or passport_id is required"})
+		return true
+	}
+	return false
+}
+
+// respondStorageError writes the response for a failed repository call: a 504
+// when a query ran out of time, a 503 when the request was cancelled, e.g. by
+// the client going away, and a 500 with the given message otherwise.
+func respondStorageError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Database query timed out"})
+	case errors.Is(err, context.Canceled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Request cancelled"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
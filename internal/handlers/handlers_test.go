@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"agnos_demo/internal/metrics"
 	"agnos_demo/internal/middleware"
 	"agnos_demo/internal/mocks"
 	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -16,31 +20,115 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func setupRouter(h *Handlers) *gin.Engine {
+	return setupRouterWithAuth(h, activeTokens())
+}
+
+func setupRouterWithAuth(h *Handlers, authStaff repository.StaffRepository) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
 	r.GET("/health", h.HealthCheck)
-	r.POST("/staff/create", h.CreateStaff)
 	r.POST("/staff/login", h.LoginStaff)
+	r.POST("/staff/token/refresh", h.RefreshToken)
 
 	protected := r.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(authStaff))
 	{
-		protected.GET("/patient/search", h.SearchPatient)
-		protected.GET("/patient/search/:id", h.GetPatientByID)
+		protected.POST("/staff/create", middleware.RequirePermission(middleware.PermissionStaffCreate), h.CreateStaff)
+		protected.POST("/staff/logout", h.Logout)
+		protected.POST("/staff/:id/deactivate", middleware.RequirePermission(middleware.PermissionStaffDeactivate), h.DeactivateStaff)
+		protected.GET("/patient/search", middleware.RequirePermission(middleware.PermissionPatientRead), h.SearchPatient)
+		protected.GET("/patient/search/:id", middleware.RequirePermission(middleware.PermissionPatientRead), h.GetPatientByID)
+		protected.POST("/patient", middleware.RequirePermission(middleware.PermissionPatientWrite), h.CreatePatient)
+		protected.PATCH("/patient/:id", middleware.RequirePermission(middleware.PermissionPatientWrite), h.UpdatePatient)
+		protected.DELETE("/patient/:id", middleware.RequirePermission(middleware.PermissionPatientWrite), h.DeletePatient)
+		protected.GET("/audit", middleware.RequirePermission(middleware.PermissionAuditRead), h.ListAuditEvents)
+		protected.GET("/audit/verify", middleware.RequirePermission(middleware.PermissionAuditRead), h.VerifyAuditTrail)
+		protected.GET("/fhir/Patient", middleware.RequirePermission(middleware.PermissionPatientRead), h.SearchFHIRPatients)
+		protected.GET("/fhir/Patient/:id", middleware.RequirePermission(middleware.PermissionPatientRead), h.GetFHIRPatient)
 	}
 	return r
 }
 
+// repos holds the repository mocks behind the handlers under test.
+type repos struct {
+	patients *mocks.MockPatientRepository
+	staff    *mocks.MockStaffRepository
+	audit    *mocks.MockAuditRepository
+}
+
+func newRepos() *repos {
+	return &repos{
+		patients: new(mocks.MockPatientRepository),
+		staff:    new(mocks.MockStaffRepository),
+		audit:    new(mocks.MockAuditRepository),
+	}
+}
+
+func (m *repos) handlers(logger *slog.Logger) *Handlers {
+	return NewHandlers(m.patients, m.staff, m.audit, logger, testFHIRBaseURL)
+}
+
+func (m *repos) assertExpectations(t *testing.T) {
+	m.patients.AssertExpectations(t)
+	m.staff.AssertExpectations(t)
+	m.audit.AssertExpectations(t)
+}
+
+// testFHIRBaseURL is the URL the FHIR endpoints are published at in tests.
+const testFHIRBaseURL = "https://fhir.example.com/fhir"
+
+// testHospitalID derives a stable hospital ID from a hospital code.
+func testHospitalID(hospital string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(hospital))
+}
+
+// testToken signs an access token for a new staff member of the hospital
+// holding the given permissions.
+func testToken(hospital string, permissions ...string) string {
+	token, _ := middleware.GenerateToken(uuid.New().String(), testHospitalID(hospital).String(), hospital, []string{}, permissions)
+	return token
+}
+
+// testPatient returns a patient registered at the given hospital.
+func testPatient(id uuid.UUID, hospital string) *models.Patient {
+	return &models.Patient{ID: id, PatientHN: "HN00000001", HospitalID: testHospitalID(hospital)}
+}
+
+// expectStaffAccess sets up the role and permission lookup performed when
+// tokens are issued, and the storage of the new refresh token.
+func expectStaffAccess(staff *mocks.MockStaffRepository, roles []string, permissions []string) {
+	staff.On("Access", mock.Anything, mock.Anything).Return(roles, permissions, nil).Once()
+	staff.On("StoreRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+}
+
+// expectAudit accepts the audit trail insert performed by handlers that
+// succeed.
+func expectAudit(audit *mocks.MockAuditRepository) {
+	audit.On("Record", mock.Anything, mock.Anything).Return(nil)
+}
+
+// testContextKey marks a request context so tests can check that it reaches
+// the repositories.
+type testContextKey struct{}
+
+// activeTokens returns a staff repository mock for AuthMiddleware that
+// reports every token as not revoked.
+func activeTokens() *mocks.MockStaffRepository {
+	authStaff := new(mocks.MockStaffRepository)
+	authStaff.On("IsAccessRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	return authStaff
+}
+
 func TestHealthCheck(t *testing.T) {
-	mockDB := new(mocks.MockDB)
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	h := NewHandlers(mockDB, logger)
+	h := newRepos().handlers(logger)
 	r := setupRouter(h)
 
 	req, _ := http.NewRequest("GET", "/health", nil)
@@ -55,99 +143,130 @@ func TestCreateStaff(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	t.Run("Success", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
+		m := newRepos()
+		expectAudit(m.audit)
 
-		// Setup expectations
 		testID := uuid.New()
-		mockRow.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
-			// Set the UUID in the first argument
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-		}).Return(nil)
-
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+		m.staff.On("Create", mock.Anything, testHospitalID("hn-001").String(), "testuser", mock.Anything, []string{middleware.RoleClerk}).Return(testID, nil)
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
 		body := `{"username": "testuser", "password": "password", "hospital": "hn-001"}`
 		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionStaffCreate))
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 		assert.Contains(t, w.Body.String(), "Staff created successfully")
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		assert.Contains(t, w.Body.String(), testID.String())
+		m.assertExpectations(t)
 	})
 
 	t.Run("Missing Fields", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		h := NewHandlers(mockDB, logger)
+		h := newRepos().handlers(logger)
 		r := setupRouter(h)
 
 		body := `{"username": "testuser"}`
 		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionStaffCreate))
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
-	t.Run("Database Error", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
+	t.Run("Different Hospital", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"username": "testuser", "password": "password", "hospital": "hn-002"}`
+		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionStaffCreate))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		m.staff.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Missing Permission", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"username": "testuser", "password": "password", "hospital": "hn-001"}`
+		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), middleware.PermissionStaffCreate)
+	})
+
+	t.Run("Unknown Role", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"username": "testuser", "password": "password", "hospital": "hn-001", "roles": ["superuser"]}`
+		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionStaffCreate))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
 
-		mockRow.On("Scan", mock.Anything).Return(errors.New("database error"))
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+	t.Run("Database Error", func(t *testing.T) {
+		m := newRepos()
+		m.staff.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(uuid.Nil, errors.New("database error"))
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
 		body := `{"username": "testuser", "password": "password", "hospital": "hn-001"}`
 		req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBufferString(body))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionStaffCreate))
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		m.assertExpectations(t)
 	})
 }
 
 func TestLoginStaff(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	staff := &models.Staff{
+		ID:           uuid.New(),
+		Username:     "loginuser",
+		PasswordHash: string(hashedPassword),
+		HospitalID:   testHospitalID("hn-001"),
+		Hospital:     "hn-001",
+		IsActive:     true,
+	}
 
 	t.Run("Success", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
-
-		testID := uuid.New()
-		mockRow.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-			if username, ok := args.Get(1).(*string); ok {
-				*username = "loginuser"
-			}
-			if passwordHash, ok := args.Get(2).(*string); ok {
-				*passwordHash = string(hashedPassword)
-			}
-			if hospital, ok := args.Get(3).(*string); ok {
-				*hospital = "hn-001"
-			}
-		}).Return(nil)
-
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
-
-		h := NewHandlers(mockDB, logger)
+		m := newRepos()
+		m.staff.On("GetActive", mock.Anything, "loginuser", "hn-001").Return(staff, nil)
+		expectStaffAccess(m.staff, []string{"clerk"}, []string{"patient:read", "patient:write"})
+		m.audit.On("Record", mock.Anything, mock.MatchedBy(func(record repository.AuditRecord) bool {
+			return record.Action == auditStaffLogin && record.StaffID == staff.ID.String()
+		})).Return(nil)
+
+		h := m.handlers(logger)
 		r := setupRouter(h)
+		logins := metrics.LoginAttempts.WithLabelValues("hn-001", metrics.LoginSuccess)
+		before := testutil.ToFloat64(logins)
 
 		body := `{"username": "loginuser", "password": "password123", "hospital": "hn-001"}`
 		req, _ := http.NewRequest("POST", "/staff/login", bytes.NewBufferString(body))
@@ -156,20 +275,24 @@ func TestLoginStaff(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Contains(t, w.Body.String(), "token")
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+
+		var response models.TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.Equal(t, before+1, testutil.ToFloat64(logins))
+		m.assertExpectations(t)
 	})
 
 	t.Run("User Not Found", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
-
-		mockRow.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("no rows"))
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+		m := newRepos()
+		m.staff.On("GetActive", mock.Anything, "nonexistent", "hn-001").Return(nil, repository.ErrNotFound)
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
+		// The hospital of an unknown user is not trusted as a label.
+		logins := metrics.LoginAttempts.WithLabelValues(metrics.UnknownHospital, metrics.LoginFailure)
+		before := testutil.ToFloat64(logins)
 
 		body := `{"username": "nonexistent", "password": "password123", "hospital": "hn-001"}`
 		req, _ := http.NewRequest("POST", "/staff/login", bytes.NewBufferString(body))
@@ -178,33 +301,15 @@ func TestLoginStaff(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		assert.Equal(t, before+1, testutil.ToFloat64(logins))
+		m.assertExpectations(t)
 	})
 
 	t.Run("Wrong Password", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
+		m := newRepos()
+		m.staff.On("GetActive", mock.Anything, "loginuser", "hn-001").Return(staff, nil)
 
-		testID := uuid.New()
-		mockRow.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-			if username, ok := args.Get(1).(*string); ok {
-				*username = "loginuser"
-			}
-			if passwordHash, ok := args.Get(2).(*string); ok {
-				*passwordHash = string(hashedPassword)
-			}
-			if hospital, ok := args.Get(3).(*string); ok {
-				*hospital = "hn-001"
-			}
-		}).Return(nil)
-
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
-
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
 		body := `{"username": "loginuser", "password": "wrongpassword", "hospital": "hn-001"}`
@@ -214,29 +319,177 @@ func TestLoginStaff(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		m.assertExpectations(t)
+		m.staff.AssertNotCalled(t, "StoreRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	})
 }
 
-func TestSearchPatient(t *testing.T) {
+func TestRefreshToken(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-	t.Run("Search Success Empty", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRows := new(mocks.MockRows)
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+
+		session := &repository.RefreshSession{
+			StaffID:  uuid.New(),
+			FamilyID: uuid.New(),
+			Hospital: models.Hospital{ID: testHospitalID("hn-001"), Code: "hn-001"},
+		}
+		m.staff.On("RotateRefreshToken", mock.Anything, middleware.HashRefreshToken("old-refresh-token")).Return(session, nil)
+		m.staff.On("Access", mock.Anything, session.StaffID).Return([]string{"clerk"}, []string{"patient:read", "patient:write"}, nil)
+		// The new refresh token stays in the session of the old one
+		m.staff.On("StoreRefreshToken", mock.Anything, session.StaffID, session.FamilyID, mock.Anything, mock.Anything).Return(nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"refresh_token": "old-refresh-token"}`
+		req, _ := http.NewRequest("POST", "/staff/token/refresh", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NotEmpty(t, response.Token)
+		assert.NotEmpty(t, response.RefreshToken)
+		assert.NotEqual(t, "old-refresh-token", response.RefreshToken)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Reused Token Revokes Session", func(t *testing.T) {
+		m := newRepos()
+		tokenHash := middleware.HashRefreshToken("rotated-refresh-token")
+		m.staff.On("RotateRefreshToken", mock.Anything, tokenHash).Return(nil, repository.ErrNotFound)
+		m.staff.On("RevokeReusedRefreshToken", mock.Anything, tokenHash).Return(int64(2), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"refresh_token": "rotated-refresh-token"}`
+		req, _ := http.NewRequest("POST", "/staff/token/refresh", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Missing Token", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("POST", "/staff/token/refresh", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		m.staff.On("RevokeAccessToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+		m.staff.On("RevokeSession", mock.Anything, mock.Anything, middleware.HashRefreshToken("refresh-token")).Return(nil).Once()
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		body := `{"refresh_token": "refresh-token"}`
+		req, _ := http.NewRequest("POST", "/staff/logout", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
 
-		// Setup expectations - no rows returned
-		mockRows.On("Next").Return(false)
-		mockRows.On("Err").Return(nil)
-		mockRows.On("Close").Return()
+	t.Run("Revoked Token Rejected", func(t *testing.T) {
+		authStaff := new(mocks.MockStaffRepository)
+		authStaff.On("IsAccessRevoked", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
 
-		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRows, nil)
+		h := newRepos().handlers(logger)
+		r := setupRouterWithAuth(h, authStaff)
 
-		h := NewHandlers(mockDB, logger)
+		token := testToken("hn-001")
+
+		req, _ := http.NewRequest("POST", "/staff/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "revoked")
+		authStaff.AssertExpectations(t)
+	})
+}
+
+func TestDeactivateStaff(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		staffID := uuid.New()
+		m.staff.On("Deactivate", mock.Anything, testHospitalID("hn-001").String(), staffID).Return(nil)
+
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionStaffDeactivate)
+
+		req, _ := http.NewRequest("POST", "/staff/"+staffID.String()+"/deactivate", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		m := newRepos()
+		m.staff.On("Deactivate", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionStaffDeactivate)
+
+		req, _ := http.NewRequest("POST", "/staff/"+uuid.New().String()+"/deactivate", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestSearchPatient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Search Success Empty", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		m.patients.On("Search", mock.Anything, mock.Anything).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
 		req, _ := http.NewRequest("GET", "/patient/search?first_name=John", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
@@ -248,50 +501,23 @@ func TestSearchPatient(t *testing.T) {
 		json.Unmarshal(w.Body.Bytes(), &response)
 		assert.Len(t, response.Patient, 0)
 
-		mockDB.AssertExpectations(t)
-		mockRows.AssertExpectations(t)
+		m.assertExpectations(t)
 	})
 
 	t.Run("Search Success With Data", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRows := new(mocks.MockRows)
-
-		// Setup expectations - 1 row returned
-		mockRows.On("Next").Return(true).Once()
-		mockRows.On("Next").Return(false).Once()
+		m := newRepos()
+		expectAudit(m.audit)
 
 		testID := uuid.New()
-		mockRows.On("Scan",
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-		).Run(func(args mock.Arguments) {
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-			if patientHN, ok := args.Get(1).(*string); ok {
-				*patientHN = "hn-001"
-			}
-			// Simulate nullable fields being populated
-			if firstNameEN, ok := args.Get(5).(**string); ok {
-				s := "John"
-				*firstNameEN = &s
-			}
-			if dob, ok := args.Get(8).(**models.Date); ok {
-				d := models.Date{Time: time.Date(1985, 3, 20, 0, 0, 0, 0, time.UTC)}
-				*dob = &d
-			}
-		}).Return(nil)
-
-		mockRows.On("Err").Return(nil)
-		mockRows.On("Close").Return()
-
-		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRows, nil)
-
-		h := NewHandlers(mockDB, logger)
-		r := setupRouter(h)
-
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		patient := testPatient(testID, "hn-001")
+		patient.FirstNameEN = "John"
+		patient.DateOfBirth = &models.Date{Time: time.Date(1985, 3, 20, 0, 0, 0, 0, time.UTC)}
+		m.patients.On("Search", mock.Anything, mock.Anything).Return(&repository.PatientPage{Patients: []*models.Patient{patient}}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
 		req, _ := http.NewRequest("GET", "/patient/search?first_name=John", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
@@ -307,21 +533,19 @@ func TestSearchPatient(t *testing.T) {
 		json.Unmarshal(w.Body.Bytes(), &response)
 		assert.Len(t, response.Patient, 1)
 		assert.Equal(t, testID, response.Patient[0].ID)
-		assert.Equal(t, "John", response.Patient[0].FirstNameEN)
+		assert.Equal(t, models.NullString("John"), response.Patient[0].FirstNameEN)
 
-		mockDB.AssertExpectations(t)
-		mockRows.AssertExpectations(t)
+		m.assertExpectations(t)
 	})
 
 	t.Run("Database Query Error", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-
-		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("db error"))
+		m := newRepos()
+		m.patients.On("Search", mock.Anything, mock.Anything).Return(nil, errors.New("db error"))
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
 		req, _ := http.NewRequest("GET", "/patient/search", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
@@ -331,69 +555,314 @@ func TestSearchPatient(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 	})
 
-	t.Run("Rows Error", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRows := new(mocks.MockRows)
+	t.Run("Query Timeout", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Search", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("unable to search patients: %w", context.DeadlineExceeded))
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
-		mockRows.On("Next").Return(false)
-		mockRows.On("Err").Return(errors.New("rows error"))
-		mockRows.On("Close").Return()
+		req, _ := http.NewRequest("GET", "/patient/search", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
-		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(mockRows, nil)
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		m.audit.AssertNotCalled(t, "Record", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Uses Request Context", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		m.patients.On("Search", mock.MatchedBy(func(ctx context.Context) bool {
+			return ctx.Value(testContextKey{}) == "search"
+		}), mock.Anything).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
-		req, _ := http.NewRequest("GET", "/patient/search", nil)
+		ctx := context.WithValue(context.Background(), testContextKey{}, "search")
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/patient/search", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
 	})
 
-	t.Run("Search With All Filters", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRows := new(mocks.MockRows)
+	t.Run("Count Error", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Search", mock.Anything, mock.Anything).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
+		m.patients.On("Count", mock.Anything, mock.Anything).Return(int64(0), errors.New("db error"))
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
 
-		mockRows.On("Next").Return(false)
-		mockRows.On("Err").Return(nil)
-		mockRows.On("Close").Return()
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
-		// Expect query with many arguments
-		mockDB.On("Query", mock.Anything, mock.Anything,
-			mock.Anything, // hospital prefix
-			mock.Anything, // patient_hn
-			mock.Anything, // national_id
-			mock.Anything, // passport_id
-			mock.Anything, // first_name
-			mock.Anything, // middle_name
-			mock.Anything, // last_name
-			mock.Anything, // dob
-		).Return(mockRows, nil)
+		req, _ := http.NewRequest("GET", "/patient/search?include_total=true", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
-		h := NewHandlers(mockDB, logger)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		m.audit.AssertNotCalled(t, "Record", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Search With All Filters", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		want := repository.PatientFilter{
+			HospitalID:  testHospitalID("hn-001").String(),
+			PatientHN:   "hn-001-01",
+			NationalID:  "1234567890121",
+			PassportID:  "AB123456",
+			DateOfBirth: "1980-01-01",
+			FirstName:   "John",
+			MiddleName:  "M",
+			LastName:    "Doe",
+		}
+		m.patients.On("Search", mock.Anything, mock.MatchedBy(func(search repository.PatientSearch) bool {
+			return search.Filter == want
+		})).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
+
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
 		// Construct URL with all parameters
-		url := "/patient/search?patient_hn=hn-001-01&national_id=123&passport_id=A123&first_name=John&middle_name=M&last_name=Doe&date_of_birth=1980-01-01"
+		url := "/patient/search?patient_hn=hn-001-01&national_id=1234567890121&passport_id=ab123456&first_name=John&middle_name=M&last_name=Doe&date_of_birth=1980-01-01"
 		req, _ := http.NewRequest("GET", url, nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRows.AssertExpectations(t)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Next Page Cursor", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		ids := []uuid.UUID{uuid.New(), uuid.New()}
+		page := &repository.PatientPage{
+			Patients: []*models.Patient{testPatient(ids[0], "hn-001"), testPatient(ids[1], "hn-001")},
+			Next:     &repository.PatientCursor{Value: "2024-01-02 00:00:00+00", ID: ids[1]},
+		}
+		m.patients.On("Search", mock.Anything, mock.MatchedBy(func(search repository.PatientSearch) bool {
+			return search.Limit == 2 && search.Sort == repository.SortCreatedAt && search.Descending && search.After == nil
+		})).Return(page, nil)
+		m.patients.On("Count", mock.Anything, mock.Anything).Return(int64(5), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search?limit=2&include_total=true", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchPatientResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Len(t, response.Patient, 2)
+		assert.Equal(t, int64(5), *response.Total)
+
+		cursor, err := decodeCursor(response.NextCursor, "-created_at")
+		assert.NoError(t, err)
+		assert.Equal(t, ids[1], cursor.ID)
+		assert.Equal(t, "2024-01-02 00:00:00+00", cursor.Value)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Cursor Is Passed On", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		after := repository.PatientCursor{Value: "Doe", ID: uuid.New()}
+		m.patients.On("Search", mock.Anything, mock.MatchedBy(func(search repository.PatientSearch) bool {
+			return search.Sort == repository.SortLastNameEN && !search.Descending && search.After != nil && *search.After == after
+		})).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+		cursor := encodeCursor(searchCursor{Sort: "last_name_en", Value: after.Value, ID: after.ID})
+
+		req, _ := http.NewRequest("GET", "/patient/search?sort=last_name_en&cursor="+cursor, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Cursor For Different Sort", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+		cursor := encodeCursor(searchCursor{Sort: "-created_at", Value: "2024-01-01", ID: uuid.New()})
+
+		req, _ := http.NewRequest("GET", "/patient/search?sort=last_name_en&cursor="+cursor, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"cursor"`)
+		m.patients.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Cursor With Bad Value", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+		for _, tc := range []struct{ query, sort, value string }{
+			{"sort=-created_at", "-created_at", "yesterday"},
+			{"sort=date_of_birth", "date_of_birth", "1990-13-45"},
+			{"sort=-score&match=fuzzy&first_name=Som", "-score", "high"},
+		} {
+			cursor := encodeCursor(searchCursor{Sort: tc.sort, Value: tc.value, ID: uuid.New()})
+			req, _ := http.NewRequest("GET", "/patient/search?"+tc.query+"&cursor="+cursor, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, tc.value)
+			assert.Contains(t, w.Body.String(), `"field":"cursor"`)
+		}
+		m.patients.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+
+		for _, value := range []string{"2024-01-02 00:00:00+00", "2024-01-02 07:30:00.123456+05:30", "2024-01-02T00:00:00.000000Z"} {
+			_, err := decodeCursor(encodeCursor(searchCursor{Sort: "-created_at", Value: value}), "-created_at")
+			assert.NoError(t, err, value)
+		}
+	})
+
+	t.Run("Invalid Filters", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search?national_id=1234567890123&date_of_birth=01-01-1980&limit=1000&sort=password_hash", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"national_id"`)
+		assert.Contains(t, w.Body.String(), `"field":"date_of_birth"`)
+		assert.Contains(t, w.Body.String(), `"field":"limit"`)
+		assert.Contains(t, w.Body.String(), `"field":"sort"`)
+		m.patients.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Scoped To Hospital ID", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		m.patients.On("Search", mock.Anything, mock.MatchedBy(func(search repository.PatientSearch) bool {
+			return search.Filter.HospitalID == testHospitalID("hn-00").String()
+		})).Return(&repository.PatientPage{Patients: []*models.Patient{}}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-00", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Fuzzy Name Match", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+
+		score := 0.5
+		patient := testPatient(uuid.New(), "hn-001")
+		patient.Score = &score
+		// Fuzzy searches default to the best matches first
+		m.patients.On("Search", mock.Anything, mock.MatchedBy(func(search repository.PatientSearch) bool {
+			return search.Filter.Fuzzy && search.Filter.FirstName == "Jon" &&
+				search.Sort == repository.SortScore && search.Descending
+		})).Return(&repository.PatientPage{Patients: []*models.Patient{patient}}, nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search?first_name=Jon&match=fuzzy", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchPatientResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Len(t, response.Patient, 1)
+		assert.Equal(t, 0.5, *response.Patient[0].Score)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Fuzzy Without Name", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search?match=fuzzy&national_id=1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"match"`)
+		m.patients.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Score Sort Without Fuzzy", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search?first_name=Jon&sort=-score", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"sort"`)
 	})
 
 	t.Run("Unauthorized", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		h := NewHandlers(mockDB, logger)
+		h := newRepos().handlers(logger)
 		r := setupRouter(h)
 
 		req, _ := http.NewRequest("GET", "/patient/search", nil)
@@ -408,99 +877,351 @@ func TestGetPatientByID(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	t.Run("Success", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
-
-		testID := uuid.New()
-		mockRow.On("Scan",
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-		).Run(func(args mock.Arguments) {
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-			if patientHN, ok := args.Get(1).(*string); ok {
-				*patientHN = "hn-001"
-			}
-		}).Return(nil)
+		m := newRepos()
+		expectAudit(m.audit)
+		m.patients.On("GetByNationalID", mock.Anything, testHospitalID("hn-001").String(), "1234567890121").Return(testPatient(uuid.New(), "hn-001"), nil)
 
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
-
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
-		req, _ := http.NewRequest("GET", "/patient/search/1234567890123", nil)
+		req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		m.assertExpectations(t)
 	})
 
 	t.Run("Not Found", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
+		m := newRepos()
+		m.patients.On("GetByNationalID", mock.Anything, mock.Anything, "1234567890121").Return(nil, repository.ErrNotFound)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
-		mockRow.On("Scan",
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-		).Return(errors.New("no rows"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		m.assertExpectations(t)
+	})
 
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+	t.Run("Database Error", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("GetByNationalID", mock.Anything, mock.Anything, "1234567890121").Return(nil, errors.New("db error"))
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Request Cancelled", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("GetByNationalID", mock.Anything, mock.Anything, "1234567890121").Return(nil, context.Canceled)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		m.assertExpectations(t)
+	})
 
-		h := NewHandlers(mockDB, logger)
+	t.Run("Invalid National ID Checksum", func(t *testing.T) {
+		h := newRepos().handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		token := testToken("hn-001", middleware.PermissionPatientRead)
 
 		req, _ := http.NewRequest("GET", "/patient/search/1234567890123", nil)
 		req.Header.Set("Authorization", "Bearer "+token)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusNotFound, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"national_id"`)
+	})
+
+	t.Run("Passport Is Normalized", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		m.patients.On("GetByPassportID", mock.Anything, testHospitalID("hn-001").String(), "AB123456").Return(testPatient(uuid.New(), "hn-001"), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search/ab%20123456", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
 	})
 
 	t.Run("Different Hospital", func(t *testing.T) {
-		mockDB := new(mocks.MockDB)
-		mockRow := new(mocks.MockRow)
+		m := newRepos()
+		m.patients.On("GetByNationalID", mock.Anything, mock.Anything, "1234567890121").Return(testPatient(uuid.New(), "hn-002"), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		token := testToken("hn-001", middleware.PermissionPatientRead)
+
+		req, _ := http.NewRequest("GET", "/patient/search/1234567890121", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		m.assertExpectations(t)
+	})
+}
 
+func TestCreatePatient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
 		testID := uuid.New()
-		mockRow.On("Scan",
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-			mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-		).Run(func(args mock.Arguments) {
-			if id, ok := args.Get(0).(*uuid.UUID); ok {
-				*id = testID
-			}
-			if patientHN, ok := args.Get(1).(*string); ok {
-				*patientHN = "hn-002" // Different hospital
-			}
-		}).Return(nil)
+		m.patients.On("Create", mock.Anything, testHospitalID("hn-001").String(), mock.MatchedBy(func(input *models.CreatePatientRequest) bool {
+			return input.NationalID == "1234567890121" && input.FirstNameEN == "John"
+		})).Return(testPatient(testID, "hn-001"), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890121", "gender": "M", "date_of_birth": "1980-01-01"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), testID.String())
+		m.assertExpectations(t)
+	})
 
-		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+	t.Run("Audited After Client Leaves", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Create", mock.Anything, mock.Anything, mock.Anything).Return(testPatient(uuid.New(), "hn-001"), nil)
+		m.audit.On("Record", mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil }), mock.Anything).Return(nil)
 
-		h := NewHandlers(mockDB, logger)
+		h := m.handlers(logger)
 		r := setupRouter(h)
 
-		token, _ := middleware.GenerateToken(uuid.New().String(), "hn-001")
+		// The client is gone by the time the patient has been created.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890121"}`
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
-		req, _ := http.NewRequest("GET", "/patient/search/1234567890123", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Missing Identifier", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Fields", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890123", "phone_number": "12345"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"national_id"`)
+		assert.Contains(t, w.Body.String(), `"field":"phone_number"`)
+	})
+
+	t.Run("Duplicate National ID", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Create", mock.Anything, mock.Anything, mock.Anything).Return(nil, &repository.DuplicateError{Field: "national_id"})
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890121"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"national_id"`)
+	})
+
+	t.Run("Already Registered At Hospital", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Create", mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrAlreadyRegistered)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890121"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already registered at this hospital")
+	})
+
+	t.Run("Missing Permission", func(t *testing.T) {
+		h := newRepos().handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"first_name_en": "John", "last_name_en": "Doe", "national_id": "1234567890121"}`
+		req, _ := http.NewRequest("POST", "/patient", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientRead))
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusForbidden, w.Code)
-		mockDB.AssertExpectations(t)
-		mockRow.AssertExpectations(t)
+	})
+}
+
+func TestUpdatePatient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		testID := uuid.New()
+		m.patients.On("Update", mock.Anything, testHospitalID("hn-001").String(), testID, mock.MatchedBy(func(input *models.UpdatePatientRequest) bool {
+			return input.PhoneNumber != nil && *input.PhoneNumber == "+66812345678"
+		})).Return(testPatient(testID, "hn-001"), nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"phone_number": "0812345678"}`
+		req, _ := http.NewRequest("PATCH", "/patient/"+testID.String(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		body := `{"phone_number": "0812345678"}`
+		req, _ := http.NewRequest("PATCH", "/patient/"+uuid.New().String(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("No Fields", func(t *testing.T) {
+		m := newRepos()
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("PATCH", "/patient/"+uuid.New().String(), bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		m.patients.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestDeletePatient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	t.Run("Success", func(t *testing.T) {
+		m := newRepos()
+		expectAudit(m.audit)
+		testID := uuid.New()
+		m.patients.On("Delete", mock.Anything, testHospitalID("hn-001").String(), testID).Return(nil)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("DELETE", "/patient/"+testID.String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		m.assertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		m := newRepos()
+		m.patients.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+
+		h := m.handlers(logger)
+		r := setupRouter(h)
+
+		req, _ := http.NewRequest("DELETE", "/patient/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+testToken("hn-001", middleware.PermissionPatientWrite))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	defaultPatientSort = "-" + repository.SortCreatedAt
+)
+
+// patientSorts are the sort keys of patient search besides score.
+var patientSorts = []string{
+	repository.SortCreatedAt,
+	repository.SortDateOfBirth,
+	repository.SortFirstNameEN,
+	repository.SortLastNameEN,
+}
+
+// searchCursor is the position after the last row of a page. It is handed to
+// clients as an opaque base64 string.
+type searchCursor struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+func encodeCursor(cursor searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string, sort string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("is malformed")
+	}
+
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("is malformed")
+	}
+	if cursor.Sort != sort {
+		return nil, errors.New("was issued for a different sort order")
+	}
+	if !validCursorValue(strings.TrimPrefix(sort, "-"), cursor.Value) {
+		return nil, errors.New("is malformed")
+	}
+	return &cursor, nil
+}
+
+// cursorTimeLayouts are the forms of created_at in cursors: the text of a
+// Postgres timestamptz, with whole-hour or other offsets, and RFC 3339.
+var cursorTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	time.RFC3339Nano,
+}
+
+// validCursorValue reports whether a cursor value parses as the type of the
+// sort key, which the repository compares it with.
+func validCursorValue(key string, value string) bool {
+	switch key {
+	case repository.SortCreatedAt:
+		for _, layout := range cursorTimeLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return true
+			}
+		}
+		return false
+	case repository.SortDateOfBirth:
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case repository.SortScore:
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	}
+	return true
+}
+
+// parseSort resolves a sort parameter such as "-created_at" into its key and
+// direction. Sorting by score is only possible in fuzzy mode.
+func parseSort(sort string, fuzzy bool) (string, string, bool, error) {
+	if sort == "" {
+		sort = defaultPatientSort
+		if fuzzy {
+			sort = "-" + repository.SortScore
+		}
+	}
+
+	key := strings.TrimPrefix(sort, "-")
+	if key == repository.SortScore {
+		if !fuzzy {
+			return "", "", false, errors.New("score is only available with match=fuzzy")
+		}
+	} else if !slices.Contains(patientSorts, key) {
+		return "", "", false, fmt.Errorf("must be one of created_at, date_of_birth, first_name_en, last_name_en or score, optionally prefixed with -")
+	}
+	return sort, key, strings.HasPrefix(sort, "-"), nil
+}
+
+func parseLimit(limit string) (int, error) {
+	if limit == "" {
+		return defaultSearchLimit, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxSearchLimit {
+		return 0, fmt.Errorf("must be a number between 1 and %d", maxSearchLimit)
+	}
+	return n, nil
+}
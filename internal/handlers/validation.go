@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"agnos_demo/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report binding errors with the JSON field names clients send.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// bindingErrors converts validator errors from ShouldBindJSON into
+// validation.Errors. Other errors, e.g. malformed JSON, are returned as is.
+func bindingErrors(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+
+	var errs validation.Errors
+	for _, fe := range verrs {
+		errs = append(errs, validation.FieldError{Field: fe.Field(), Message: bindingMessage(fe)})
+	}
+	return errs
+}
+
+func bindingMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "datetime":
+		return "must be a date in YYYY-MM-DD format"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", fe.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+// respondValidationError writes a 400 listing every invalid field, or the
+// plain error message when err carries no field information.
+func respondValidationError(c *gin.Context, err error) {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": errs})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,96 @@
+// Package logging builds the slog logger shared by the commands, the HTTP
+// server and its handlers, and carries per-request loggers in contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"agnos_demo/internal/tracing"
+
+	"github.com/lmittmann/tint"
+	"github.com/spf13/viper"
+)
+
+// unredactedEnvironments may log personal data as it is, and mask it by
+// default. Other environments hash it by default.
+var unredactedEnvironments = []string{"dev", "test"}
+
+type Config struct {
+	Level string // debug, info, warn or error
+	Color bool   // colors the level of text output; ignored for JSON
+	JSON  bool
+
+	Redaction    string // mask, hash or none
+	RedactionKey string // HMAC key of the hash redaction
+}
+
+func InitConfig() (*Config, error) {
+	config := &Config{
+		Level:        viper.GetString("Log.Level"),
+		Color:        viper.GetBool("Log.Color"),
+		JSON:         viper.GetBool("Log.JSON"),
+		Redaction:    viper.GetString("Log.Redaction"),
+		RedactionKey: viper.GetString("Log.RedactionKey"),
+	}
+
+	environment := viper.GetString("App.Environment")
+	unredacted := slices.Contains(unredactedEnvironments, environment)
+	switch {
+	case config.Redaction == "" && unredacted:
+		config.Redaction = RedactMask
+	case config.Redaction == "":
+		config.Redaction = RedactHash
+	case config.Redaction == RedactNone && !unredacted:
+		return nil, fmt.Errorf("Log.Redaction %s is not allowed in the %q environment", RedactNone, environment)
+	}
+	return config, nil
+}
+
+// New returns a logger writing to w at the configured level, as JSON or as
+// text. Personal data logged with the attributes of this package is redacted,
+// and records logged with a context carry its trace and span IDs.
+func New(w io.Writer, config *Config) (*slog.Logger, error) {
+	var level slog.Level
+	if config.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", config.Level, err)
+		}
+	}
+
+	var handler slog.Handler
+	if config.JSON {
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	} else {
+		handler = tint.NewHandler(w, &tint.Options{
+			Level:      level,
+			TimeFormat: time.DateTime,
+			NoColor:    !config.Color,
+		})
+	}
+	redacted, err := NewRedactHandler(tracing.NewLogHandler(handler), config.Redaction, []byte(config.RedactionKey))
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(redacted), nil
+}
+
+type contextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger, for the code handling a
+// request to log with.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if there is none.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
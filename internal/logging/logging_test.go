@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, &Config{Level: "info", JSON: true})
+		require.NoError(t, err)
+
+		logger.Debug("hidden")
+		logger.Info("shown", "req_id", "abc")
+
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record), buf.String())
+		assert.Equal(t, "shown", record["msg"])
+		assert.Equal(t, "abc", record["req_id"])
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, &Config{Level: "warn"})
+		require.NoError(t, err)
+
+		logger.Info("hidden")
+		logger.Warn("shown", "req_id", "abc")
+
+		assert.Contains(t, buf.String(), "WRN shown req_id=abc")
+		assert.NotContains(t, buf.String(), "hidden")
+		assert.NotContains(t, buf.String(), "\x1b[", "colors are off unless configured")
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := New(&buf, &Config{Color: true})
+		require.NoError(t, err)
+
+		logger.Info("shown")
+		assert.Contains(t, buf.String(), "\x1b[")
+	})
+
+	t.Run("Invalid Level", func(t *testing.T) {
+		_, err := New(&bytes.Buffer{}, &Config{Level: "verbose"})
+		assert.ErrorContains(t, err, `invalid log level "verbose"`)
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	fallback := slog.New(slog.DiscardHandler)
+	assert.Same(t, fallback, FromContext(context.Background(), fallback))
+
+	logger := fallback.With("req_id", "abc")
+	assert.Same(t, logger, FromContext(WithLogger(context.Background(), logger), fallback))
+}
@@ -0,0 +1,250 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redaction modes accepted for Log.Redaction.
+const (
+	RedactMask = "mask" // keeps a hint of the value, such as its last digits
+	RedactHash = "hash" // a keyed hash, equal for equal values
+	RedactNone = "none" // logs values as they are
+)
+
+// Kind is the kind of personal data a value holds, which decides how it is
+// masked.
+type Kind string
+
+const (
+	KindNationalID Kind = "national_id"
+	KindPassport   Kind = "passport"
+	KindName       Kind = "name"
+	KindUsername   Kind = "username"
+	KindPhone      Kind = "phone"
+	KindEmail      Kind = "email"
+	KindBirthDate  Kind = "birth_date"
+	KindOther      Kind = "other"
+)
+
+// Sensitive is a personal value that a RedactHandler logs redacted. Loggers
+// without one log it masked, so the raw value never reaches their output.
+type Sensitive struct {
+	Kind  Kind
+	Value string
+}
+
+func (s Sensitive) LogValue() slog.Value {
+	return s.redact(mask)
+}
+
+func (s Sensitive) redact(redact func(Kind, string) string) slog.Value {
+	return slog.StringValue(redact(s.Kind, s.Value))
+}
+
+func NationalID(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindNationalID, Value: value})
+}
+
+func Passport(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindPassport, Value: value})
+}
+
+func Name(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindName, Value: value})
+}
+
+func Username(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindUsername, Value: value})
+}
+
+func Phone(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindPhone, Value: value})
+}
+
+func Email(key, value string) slog.Attr {
+	return slog.Any(key, Sensitive{Kind: KindEmail, Value: value})
+}
+
+// publicQueryParams are the query parameters of the REST, FHIR and audit
+// endpoints that carry no personal data. All others are logged redacted, so
+// a parameter added later is safe until it is listed here.
+var publicQueryParams = map[string]bool{
+	"limit":         true,
+	"sort":          true,
+	"match":         true,
+	"include_total": true,
+	"_count":        true,
+	"_offset":       true,
+	"staff_id":      true,
+	"patient_id":    true,
+	"from":          true,
+	"to":            true,
+}
+
+// queryParamKinds are the kinds of the query parameters known to carry
+// personal data, which keep a hint of their values when masked. Search
+// cursors encode the sort key of a patient, which may be a name or a date of
+// birth, and are masked like any parameter not listed.
+var queryParamKinds = map[string]Kind{
+	"national_id":   KindNationalID,
+	"passport_id":   KindPassport,
+	"first_name":    KindName,
+	"middle_name":   KindName,
+	"last_name":     KindName,
+	"family":        KindName,
+	"given":         KindName,
+	"date_of_birth": KindBirthDate,
+	"birthdate":     KindBirthDate,
+	"phone_number":  KindPhone,
+	"email":         KindEmail,
+}
+
+// Query logs the query parameters of a request with the values of all but
+// publicQueryParams redacted.
+func Query(key string, values url.Values) slog.Attr {
+	return slog.Any(key, sensitiveQuery(values))
+}
+
+type sensitiveQuery url.Values
+
+func (q sensitiveQuery) LogValue() slog.Value {
+	return q.redact(mask)
+}
+
+func (q sensitiveQuery) redact(redact func(Kind, string) string) slog.Value {
+	redacted := url.Values{}
+	for param, values := range q {
+		kind, ok := queryParamKinds[param]
+		if !ok {
+			kind = KindOther
+		}
+		for _, value := range values {
+			if !publicQueryParams[param] {
+				value = redact(kind, value)
+			}
+			redacted.Add(param, value)
+		}
+	}
+	// Encoded as is, masks would read as %2A%2A%2A.
+	s, _ := url.QueryUnescape(redacted.Encode())
+	return slog.StringValue(s)
+}
+
+// redactable is implemented by the values that a RedactHandler redacts.
+type redactable interface {
+	redact(redact func(Kind, string) string) slog.Value
+}
+
+// RedactHandler redacts the Sensitive values and queries of the records it
+// handles, including those in groups and in attributes added by WithAttrs.
+type RedactHandler struct {
+	slog.Handler
+	redact func(Kind, string) string
+}
+
+// NewRedactHandler returns a handler redacting personal data in the given
+// mode before passing records on to handler. The hash mode uses key as the
+// HMAC key; with no key a random one is used, so hashes only match within
+// the process.
+func NewRedactHandler(handler slog.Handler, mode string, key []byte) (*RedactHandler, error) {
+	h := &RedactHandler{Handler: handler}
+	switch mode {
+	case RedactMask, "":
+		h.redact = mask
+	case RedactHash:
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("unable to generate redaction key: %w", err)
+			}
+		}
+		h.redact = func(kind Kind, value string) string {
+			if value == "" {
+				return ""
+			}
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(value))
+			return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:12])
+		}
+	case RedactNone:
+		h.redact = func(kind Kind, value string) string { return value }
+	default:
+		return nil, fmt.Errorf("unknown log redaction %q", mode)
+	}
+	return h, nil
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return &RedactHandler{Handler: h.Handler.WithAttrs(redacted), redact: h.redact}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{Handler: h.Handler.WithGroup(name), redact: h.redact}
+}
+
+func (h *RedactHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindLogValuer {
+		if value, ok := attr.Value.Any().(redactable); ok {
+			return slog.Attr{Key: attr.Key, Value: value.redact(h.redact)}
+		}
+		// Other values may resolve to groups holding sensitive ones.
+		attr.Value = attr.Value.Resolve()
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		group := attr.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = h.redactAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	}
+	return attr
+}
+
+// mask hides all of a value but a hint of it: the last digits of numbers, the
+// initial of names and the domain of email addresses.
+func mask(kind Kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch kind {
+	case KindNationalID, KindPassport, KindPhone:
+		// At most the last 4 characters, and never more than a third.
+		n := utf8.RuneCountInString(value)
+		keep := min(4, n/3)
+		runes := []rune(value)
+		return strings.Repeat("*", n-keep) + string(runes[n-keep:])
+	case KindName, KindUsername:
+		initial, _ := utf8.DecodeRuneInString(value)
+		return string(initial) + "***"
+	case KindEmail:
+		if at := strings.LastIndexByte(value, '@'); at > 0 {
+			initial, _ := utf8.DecodeRuneInString(value)
+			return string(initial) + "***" + value[at:]
+		}
+		return "***"
+	}
+	return "***"
+}
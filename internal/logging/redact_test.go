@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logJSON logs attrs through a RedactHandler in mode and returns the record.
+func logJSON(t *testing.T, mode string, key []byte, attrs ...any) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	handler, err := NewRedactHandler(slog.NewJSONHandler(&buf, nil), mode, key)
+	require.NoError(t, err)
+	slog.New(handler).Info("test", attrs...)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record), buf.String())
+	return record
+}
+
+func TestMask(t *testing.T) {
+	for _, tc := range []struct {
+		attr slog.Attr
+		want string
+	}{
+		{NationalID("v", "1234567890121"), "*********0121"},
+		{Passport("v", "AB1234567"), "******567"},
+		{Phone("v", "+66812345678"), "********5678"},
+		{Name("v", "Somchai"), "S***"},
+		{Name("v", "สมชาย"), "ส***"},
+		{Username("v", "somchai.j"), "s***"},
+		{Email("v", "somchai@example.com"), "s***@example.com"},
+		{Email("v", "not an email"), "***"},
+		{Name("v", ""), ""},
+	} {
+		assert.Equal(t, tc.want, logJSON(t, RedactMask, nil, tc.attr)["v"], tc.attr.Value.Any())
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+	raw := []string{"1234567890121", "Somchai", "Jaidee", "1990-05-17", "somchai@example.com"}
+	query := url.Values{"first_name": {"Somchai"}, "date_of_birth": {"1990-05-17"}, "limit": {"10"}}
+
+	t.Run("No Raw PII", func(t *testing.T) {
+		for _, mode := range []string{RedactMask, RedactHash} {
+			var buf bytes.Buffer
+			handler, err := NewRedactHandler(slog.NewJSONHandler(&buf, nil), mode, nil)
+			require.NoError(t, err)
+
+			logger := slog.New(handler).With(NationalID("national_id", "1234567890121"))
+			logger.Info("test",
+				slog.Group("patient", Name("last_name", "Jaidee"), Email("email", "somchai@example.com")),
+				Query("query", query),
+			)
+			logger.WithGroup("staff").Info("test", Username("username", "Somchai"))
+
+			for _, value := range raw {
+				assert.NotContains(t, buf.String(), value, mode)
+			}
+			assert.Contains(t, buf.String(), "limit=10", "other parameters are kept")
+		}
+	})
+
+	t.Run("Unknown Parameters", func(t *testing.T) {
+		record := logJSON(t, RedactMask, nil, Query("query", url.Values{
+			"limit": {"10"}, "_count": {"5"}, "mrn": {"1234567890121"}, "name": {"Somchai"},
+		}))
+		assert.Equal(t, "_count=5&limit=10&mrn=***&name=***", record["query"])
+	})
+
+	t.Run("Hash", func(t *testing.T) {
+		record := logJSON(t, RedactHash, []byte("key"), NationalID("a", "1234567890121"), Passport("b", "1234567890121"), NationalID("c", "1234567890122"))
+		assert.Regexp(t, "^hmac:[0-9a-f]{24}$", record["a"])
+		assert.Equal(t, record["a"], record["b"], "equal values hash alike")
+		assert.NotEqual(t, record["a"], record["c"])
+
+		other := logJSON(t, RedactHash, []byte("other key"), NationalID("a", "1234567890121"))
+		assert.NotEqual(t, record["a"], other["a"])
+	})
+
+	t.Run("None", func(t *testing.T) {
+		record := logJSON(t, RedactNone, nil, NationalID("national_id", "1234567890121"), Query("query", query))
+		assert.Equal(t, "1234567890121", record["national_id"])
+		assert.Equal(t, "date_of_birth=1990-05-17&first_name=Somchai&limit=10", record["query"])
+	})
+
+	t.Run("Masked Without Handler", func(t *testing.T) {
+		var buf bytes.Buffer
+		slog.New(slog.NewJSONHandler(&buf, nil)).Info("test", NationalID("national_id", "1234567890121"), Query("query", query))
+		for _, value := range raw {
+			assert.NotContains(t, buf.String(), value)
+		}
+	})
+
+	t.Run("Unknown Mode", func(t *testing.T) {
+		_, err := NewRedactHandler(slog.NewJSONHandler(&bytes.Buffer{}, nil), "partial", nil)
+		assert.ErrorContains(t, err, `unknown log redaction "partial"`)
+	})
+}
+
+func TestInitConfigRedaction(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, tc := range []struct {
+		environment string
+		redaction   string
+		want        string
+		wantErr     bool
+	}{
+		{environment: "dev", want: RedactMask},
+		{environment: "test", want: RedactMask},
+		{environment: "demo", want: RedactHash},
+		{environment: "production", want: RedactHash},
+		{environment: "dev", redaction: RedactNone, want: RedactNone},
+		{environment: "production", redaction: RedactMask, want: RedactMask},
+		{environment: "production", redaction: RedactNone, wantErr: true},
+	} {
+		viper.Set("App.Environment", tc.environment)
+		viper.Set("Log.Redaction", tc.redaction)
+
+		config, err := InitConfig()
+		if tc.wantErr {
+			assert.Error(t, err, tc.environment)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, config.Redaction, "%s %s", tc.environment, tc.redaction)
+	}
+}
@@ -0,0 +1,80 @@
+// Package metrics defines the Prometheus metrics of the API server and the
+// registry they are served from on the admin port.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "agnos"
+
+// Login results counted by LoginAttempts.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// UnknownHospital labels failed logins whose hospital could not be confirmed,
+// so that made-up hospital codes do not create new series.
+const UnknownHospital = "unknown"
+
+// Registry holds every metric served at /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts handled requests by method, route template and
+	// status. Requests that match no route have an empty route.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes how long requests take to handle.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// LoginAttempts counts staff logins by hospital code and result.
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "login_attempts_total",
+		Help:      "Staff login attempts, by hospital and result.",
+	}, []string{"hospital", "result"})
+
+	// PatientSearchResults observes the number of patients returned by a
+	// search page, by API ("rest" or "fhir").
+	PatientSearchResults = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "patient",
+		Name:      "search_results",
+		Help:      "Patients returned per search page, by API.",
+		Buckets:   []float64{0, 1, 2, 5, 10, 20, 50, 100},
+	}, []string{"api"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		LoginAttempts,
+		PatientSearchResults,
+	)
+}
+
+// Handler serves the metrics in Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
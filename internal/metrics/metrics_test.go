@@ -0,0 +1,66 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agnos_demo/internal/metrics"
+	"agnos_demo/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.MetricsMiddleware())
+	r.GET("/patient/search/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	requests := metrics.HTTPRequests.WithLabelValues("GET", "/patient/search/:id", "404")
+	before := testutil.ToFloat64(requests)
+
+	for _, id := range []string{"1234567890121", "AB123456"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/patient/search/"+id, nil))
+	}
+
+	// Both paths are counted under the route template
+	assert.Equal(t, before+2, testutil.ToFloat64(requests))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.HTTPRequestDuration.MustCurryWith(prometheus.Labels{"route": "/patient/search/:id"})))
+}
+
+func TestPoolCollector(t *testing.T) {
+	// The pool connects lazily, so no database is needed to read its stats.
+	pool, err := pgxpool.New(context.Background(), "postgres://user@localhost:1/db?pool_max_conns=7")
+	require.NoError(t, err)
+	defer pool.Close()
+
+	collector := metrics.NewPoolCollector(pool)
+	assert.Equal(t, 9, testutil.CollectAndCount(collector))
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP agnos_db_pool_max_connections Maximum size of the pool.
+# TYPE agnos_db_pool_max_connections gauge
+agnos_db_pool_max_connections 7
+# HELP agnos_db_pool_acquired_connections Connections currently in use.
+# TYPE agnos_db_pool_acquired_connections gauge
+agnos_db_pool_acquired_connections 0
+`), "agnos_db_pool_max_connections", "agnos_db_pool_acquired_connections"))
+}
+
+func TestHandler(t *testing.T) {
+	metrics.LoginAttempts.WithLabelValues("hn-001", metrics.LoginSuccess).Inc()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `agnos_auth_login_attempts_total{hospital="hn-001",result="success"}`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
@@ -1,17 +1,32 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"agnos_demo/internal/logging"
+	"agnos_demo/internal/repository"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts valid access tokens that staff has not revoked: a
+// token is rejected when its jti has been revoked (logout) or when the staff
+// member it was issued to has been deactivated since.
+func AuthMiddleware(staff repository.StaffRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -40,32 +55,113 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Check expiration
-			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-				c.Abort()
-				return
-			}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Abort()
+			return
+		}
 
-			c.Set("user_id", claims["user_id"])
-			c.Set("hospital", claims["hospital"])
-		} else {
+		// Check expiration
+		exp, ok := claims["exp"].(float64)
+		if !ok || float64(time.Now().Unix()) > exp {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		hospitalID, _ := claims["hospital_id"].(string)
+		jti, _ := claims["jti"].(string)
+		if userID == "" || hospitalID == "" || jti == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
 
+		revoked, err := staff.IsAccessRevoked(c.Request.Context(), jti, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Database query timed out"})
+			case errors.Is(err, context.Canceled):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Request cancelled"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate token"})
+			}
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Set("hospital_id", hospitalID)
+		c.Set("hospital", claims["hospital"])
+		c.Set("roles", claimStrings(claims["roles"]))
+		c.Set("permissions", claimStrings(claims["permissions"]))
+		c.Set("jti", jti)
+		c.Set("token_expires_at", time.Unix(int64(exp), 0))
+
+		if logger := logging.FromContext(c.Request.Context(), nil); logger != nil {
+			hospital, _ := claims["hospital"].(string)
+			logger = logger.With(slog.String("user_id", userID), slog.String("hospital", hospital))
+			c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+		}
+
 		c.Next()
 	}
 }
 
-func GenerateToken(userID string, hospital string) (string, error) {
+// AccessTokenTTL is the lifetime of access tokens issued by GenerateToken.
+func AccessTokenTTL() time.Duration {
+	if ttl := viper.GetDuration("Auth.AccessTokenTTL"); ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+// RefreshTokenTTL is the lifetime of a refresh token before it must be rotated.
+func RefreshTokenTTL() time.Duration {
+	if ttl := viper.GetDuration("Auth.RefreshTokenTTL"); ttl > 0 {
+		return ttl
+	}
+	return 7 * 24 * time.Hour
+}
+
+// GenerateToken signs an access token. Data access is scoped by hospitalID;
+// the hospital code is carried along for display and logging.
+func GenerateToken(userID string, hospitalID string, hospital string, roles []string, permissions []string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  userID,
-		"hospital": hospital,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+		"jti":         uuid.New().String(),
+		"user_id":     userID,
+		"hospital_id": hospitalID,
+		"hospital":    hospital,
+		"roles":       roles,
+		"permissions": permissions,
+		"exp":         time.Now().Add(AccessTokenTTL()).Unix(),
 	})
 
 	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
 }
+
+// GenerateRefreshToken returns a new opaque refresh token together with the
+// hash under which it is persisted.
+func GenerateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex encoded SHA-256 of a refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,33 +2,42 @@ package middleware
 
 import (
 	"log/slog"
-	"os"
 	"time"
 
+	"agnos_demo/internal/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-func SlogMiddleware() gin.HandlerFunc {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-
+// SlogMiddleware logs each request and puts a child of logger carrying its
+// req_id in the request context, so that handler log lines can be matched to
+// the request. AuthMiddleware adds the staff member to it.
+func SlogMiddleware(logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		reqID := uuid.New().String()
 		c.Writer.Header().Set("X-Request-ID", reqID)
+		c.Set("req_id", reqID)
 		requestLogger := logger.With(slog.String("req_id", reqID))
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), requestLogger))
 
-		requestLogger.Info("request received",
+		requestLogger.InfoContext(c.Request.Context(), "request received",
 			slog.String("method", c.Request.Method),
-			slog.String("path", c.Request.URL.Path),
-			slog.String("query", c.Request.URL.RawQuery),
+			// The route rather than the path, which may hold a patient
+			// identifier.
+			slog.String("route", c.FullPath()),
+			logging.Query("query", c.Request.URL.Query()),
 			slog.String("ip", c.ClientIP()),
 			slog.String("user-agent", c.Request.UserAgent()),
 		)
 
 		c.Next()
 
-		requestLogger.Info("request processed",
+		// Pick up the user_id and hospital added once the request was
+		// authenticated.
+		ctx := c.Request.Context()
+		logging.FromContext(ctx, requestLogger).InfoContext(ctx, "request processed",
 			slog.Int("status", c.Writer.Status()),
 			slog.Duration("latency", time.Since(start)),
 			slog.String("ip", c.ClientIP()),
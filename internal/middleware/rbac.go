@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles seeded by migration 0004.
+const (
+	RoleHospitalAdmin = "hospital_admin"
+	RoleClerk         = "clerk"
+	RoleDoctor        = "doctor"
+	RoleAuditor       = "auditor"
+)
+
+// Permissions seeded by migration 0004 and carried in the access token.
+const (
+	PermissionStaffCreate     = "staff:create"
+	PermissionStaffDeactivate = "staff:deactivate"
+	PermissionPatientRead     = "patient:read"
+	PermissionPatientWrite    = "patient:write"
+	PermissionAuditRead       = "audit:read"
+)
+
+// RequirePermission aborts with 403 unless the authenticated staff member holds
+// every given permission. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("permissions")
+
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "required": permission})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func claimStrings(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return []string{}
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
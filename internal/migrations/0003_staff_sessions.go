@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0003Forwards = `
+	ALTER TABLE staff ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE staff ADD COLUMN deactivated_at TIMESTAMP WITH TIME ZONE;
+
+	-- Rotating refresh tokens. Only the SHA-256 hash of the token is stored.
+	-- Tokens issued from the same login share a family_id so that reuse of a
+	-- rotated token can revoke the whole session.
+	CREATE TABLE refresh_tokens (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		staff_id UUID NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+		family_id UUID NOT NULL,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Denylist of access token IDs (jti) revoked before their expiry.
+	CREATE TABLE revoked_tokens (
+		jti UUID PRIMARY KEY,
+		staff_id UUID NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		revoked_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX idx_refresh_tokens_staff_id ON refresh_tokens(staff_id);
+	CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+	CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+`
+
+	migration0003Backwards = `
+	DROP TABLE revoked_tokens;
+	DROP TABLE refresh_tokens;
+
+	ALTER TABLE staff DROP COLUMN deactivated_at;
+	ALTER TABLE staff DROP COLUMN is_active;
+`
+)
+
+var migration0003StaffSessions = &Migration{
+	Number: 3,
+	Name:   "Add refresh tokens and token revocation",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0003Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Staff session tables created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0003Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Staff session tables dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0003Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0003StaffSessions)
+}
@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0004Forwards = `
+	CREATE TABLE roles (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(50) UNIQUE NOT NULL,
+		description TEXT
+	);
+
+	CREATE TABLE permissions (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) UNIQUE NOT NULL,
+		description TEXT
+	);
+
+	CREATE TABLE role_permissions (
+		role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+		PRIMARY KEY (role_id, permission_id)
+	);
+
+	CREATE TABLE staff_roles (
+		staff_id UUID NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+		role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		PRIMARY KEY (staff_id, role_id)
+	);
+
+	CREATE INDEX idx_staff_roles_role_id ON staff_roles(role_id);
+
+	INSERT INTO roles (name, description) VALUES
+	('hospital_admin', 'Manages staff and patients of a hospital'),
+	('clerk', 'Registers and maintains patient records'),
+	('doctor', 'Reads patient records'),
+	('auditor', 'Reviews the access audit trail');
+
+	INSERT INTO permissions (name, description) VALUES
+	('staff:create', 'Create staff accounts'),
+	('staff:deactivate', 'Deactivate staff accounts'),
+	('patient:read', 'Search and read patient records'),
+	('patient:write', 'Create, update and delete patient records'),
+	('audit:read', 'Read the access audit trail');
+
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r, permissions p
+	WHERE (r.name, p.name) IN (
+		('hospital_admin', 'staff:create'),
+		('hospital_admin', 'staff:deactivate'),
+		('hospital_admin', 'patient:read'),
+		('hospital_admin', 'patient:write'),
+		('hospital_admin', 'audit:read'),
+		('clerk', 'patient:read'),
+		('clerk', 'patient:write'),
+		('doctor', 'patient:read'),
+		('auditor', 'audit:read')
+	);
+
+	-- Existing staff had unrestricted access; keep it that way until an
+	-- admin assigns narrower roles.
+	INSERT INTO staff_roles (staff_id, role_id)
+	SELECT s.id, r.id FROM staff s, roles r WHERE r.name = 'hospital_admin';
+`
+
+	migration0004Backwards = `
+	DROP TABLE staff_roles;
+	DROP TABLE role_permissions;
+	DROP TABLE permissions;
+	DROP TABLE roles;
+`
+)
+
+var migration0004RolesAndPermissions = &Migration{
+	Number: 4,
+	Name:   "Add roles and permissions",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0004Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Roles and permissions created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0004Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Roles and permissions tables dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0004Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0004RolesAndPermissions)
+}
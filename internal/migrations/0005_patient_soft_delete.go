@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0005Forwards = `
+	ALTER TABLE patients ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+	ALTER TABLE patients ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+	-- Uniqueness only applies to live records so that a soft-deleted
+	-- patient can be registered again.
+	ALTER TABLE patients DROP CONSTRAINT patients_national_id_key;
+	ALTER TABLE patients DROP CONSTRAINT patients_passport_id_key;
+	ALTER TABLE patients DROP CONSTRAINT patients_email_key;
+	DROP INDEX idx_patients_national_id;
+	DROP INDEX idx_patients_passport_id;
+
+	CREATE UNIQUE INDEX uq_patients_national_id ON patients(national_id) WHERE deleted_at IS NULL;
+	CREATE UNIQUE INDEX uq_patients_passport_id ON patients(passport_id) WHERE deleted_at IS NULL;
+	CREATE UNIQUE INDEX uq_patients_email ON patients(email) WHERE deleted_at IS NULL;
+
+	-- Enforced for new and updated rows only; existing rows are not rechecked.
+	ALTER TABLE patients ADD CONSTRAINT chk_patients_identifier
+		CHECK (national_id IS NOT NULL OR passport_id IS NOT NULL) NOT VALID;
+`
+
+	migration0005Backwards = `
+	-- Identifiers were unique across all records before soft delete, so
+	-- soft-deleted patients are removed for good.
+	DELETE FROM patients WHERE deleted_at IS NOT NULL;
+
+	ALTER TABLE patients DROP CONSTRAINT chk_patients_identifier;
+	DROP INDEX uq_patients_national_id;
+	DROP INDEX uq_patients_passport_id;
+	DROP INDEX uq_patients_email;
+
+	ALTER TABLE patients ADD CONSTRAINT patients_national_id_key UNIQUE (national_id);
+	ALTER TABLE patients ADD CONSTRAINT patients_passport_id_key UNIQUE (passport_id);
+	ALTER TABLE patients ADD CONSTRAINT patients_email_key UNIQUE (email);
+	CREATE INDEX idx_patients_national_id ON patients(national_id);
+	CREATE INDEX idx_patients_passport_id ON patients(passport_id);
+
+	ALTER TABLE patients DROP COLUMN deleted_at;
+	ALTER TABLE patients DROP COLUMN updated_at;
+`
+)
+
+var migration0005PatientSoftDelete = &Migration{
+	Number: 5,
+	Name:   "Add patient soft delete",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0005Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient soft delete columns created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0005Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient soft delete columns dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0005Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0005PatientSoftDelete)
+}
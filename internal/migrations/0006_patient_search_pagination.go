@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0006Forwards = `
+	-- Keyset pagination compares (created_at, id), which requires a value.
+	UPDATE patients SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+	ALTER TABLE patients ALTER COLUMN created_at SET NOT NULL;
+
+	CREATE INDEX idx_patients_created_at_id ON patients(created_at, id) WHERE deleted_at IS NULL;
+`
+
+	migration0006Backwards = `
+	DROP INDEX idx_patients_created_at_id;
+	ALTER TABLE patients ALTER COLUMN created_at DROP NOT NULL;
+`
+)
+
+var migration0006PatientSearchPagination = &Migration{
+	Number: 6,
+	Name:   "Index patients for keyset pagination",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0006Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient pagination index created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0006Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient search pagination index dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0006Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0006PatientSearchPagination)
+}
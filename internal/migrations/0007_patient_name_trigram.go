@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// The GIN trigram indexes serve both the ILIKE filters of the default
+	// search mode and the % similarity operator of fuzzy search.
+	migration0007Forwards = `
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+	CREATE INDEX idx_patients_first_name_th_trgm ON patients USING GIN (first_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_middle_name_th_trgm ON patients USING GIN (middle_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_last_name_th_trgm ON patients USING GIN (last_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_first_name_en_trgm ON patients USING GIN (first_name_en gin_trgm_ops);
+	CREATE INDEX idx_patients_middle_name_en_trgm ON patients USING GIN (middle_name_en gin_trgm_ops);
+	CREATE INDEX idx_patients_last_name_en_trgm ON patients USING GIN (last_name_en gin_trgm_ops);
+`
+
+	migration0007Backwards = `
+	DROP INDEX idx_patients_first_name_th_trgm;
+	DROP INDEX idx_patients_middle_name_th_trgm;
+	DROP INDEX idx_patients_last_name_th_trgm;
+	DROP INDEX idx_patients_first_name_en_trgm;
+	DROP INDEX idx_patients_middle_name_en_trgm;
+	DROP INDEX idx_patients_last_name_en_trgm;
+
+	DROP EXTENSION IF EXISTS pg_trgm;
+`
+)
+
+var migration0007PatientNameTrigram = &Migration{
+	Number: 7,
+	Name:   "Add trigram indexes on patient names",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0007Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient name trigram indexes created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0007Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Patient name trigram indexes dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0007Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0007PatientNameTrigram)
+}
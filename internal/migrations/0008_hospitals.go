@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0008Forwards = `
+	CREATE TABLE hospitals (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		code VARCHAR(50) UNIQUE NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		last_hn BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Until now staff.hospital and patients.patient_hn both held the
+	-- hospital code, so every code in use becomes a hospital.
+	INSERT INTO hospitals (code, name)
+	SELECT code, code FROM (
+		SELECT hospital AS code FROM staff
+		UNION
+		SELECT patient_hn FROM patients
+	) codes;
+
+	ALTER TABLE staff ADD COLUMN hospital_id UUID REFERENCES hospitals(id);
+	UPDATE staff s SET hospital_id = h.id FROM hospitals h WHERE h.code = s.hospital;
+	ALTER TABLE staff ALTER COLUMN hospital_id SET NOT NULL;
+	ALTER TABLE staff DROP COLUMN hospital;
+	CREATE INDEX idx_staff_hospital_id ON staff(hospital_id);
+
+	ALTER TABLE patients ADD COLUMN hospital_id UUID REFERENCES hospitals(id);
+	UPDATE patients p SET hospital_id = h.id FROM hospitals h WHERE h.code = p.patient_hn;
+	ALTER TABLE patients ALTER COLUMN hospital_id SET NOT NULL;
+
+	-- Give existing patients real hospital numbers in registration order.
+	UPDATE patients p SET patient_hn = 'HN' || lpad(numbered.n::text, 8, '0')
+	FROM (
+		SELECT id, row_number() OVER (PARTITION BY hospital_id ORDER BY created_at, id) AS n
+		FROM patients
+	) numbered
+	WHERE numbered.id = p.id;
+
+	UPDATE hospitals h SET last_hn = counts.n
+	FROM (SELECT hospital_id, COUNT(*) AS n FROM patients GROUP BY hospital_id) counts
+	WHERE counts.hospital_id = h.id;
+
+	-- New patients draw the next number of their hospital. The counter
+	-- row is locked until the inserting transaction ends, so numbers are
+	-- never handed out twice and a failed insert does not leave a gap.
+	CREATE FUNCTION assign_patient_hn() RETURNS TRIGGER AS $$
+	BEGIN
+		IF NEW.patient_hn IS NULL THEN
+			UPDATE hospitals SET last_hn = last_hn + 1
+			WHERE id = NEW.hospital_id
+			RETURNING 'HN' || lpad(last_hn::text, 8, '0') INTO NEW.patient_hn;
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER trg_patients_assign_hn BEFORE INSERT ON patients
+		FOR EACH ROW EXECUTE FUNCTION assign_patient_hn();
+
+	DROP INDEX idx_patients_patient_hn;
+	CREATE UNIQUE INDEX uq_patients_hospital_hn ON patients(hospital_id, patient_hn);
+
+	-- Search always filters by hospital, so lead the keyset index with it.
+	DROP INDEX idx_patients_created_at_id;
+	CREATE INDEX idx_patients_hospital_created_at_id ON patients(hospital_id, created_at, id) WHERE deleted_at IS NULL;
+`
+
+	migration0008Backwards = `
+	DROP INDEX idx_patients_hospital_created_at_id;
+	CREATE INDEX idx_patients_created_at_id ON patients(created_at, id) WHERE deleted_at IS NULL;
+
+	DROP TRIGGER trg_patients_assign_hn ON patients;
+	DROP FUNCTION assign_patient_hn();
+
+	-- patient_hn goes back to holding the hospital code; the assigned
+	-- hospital numbers are lost.
+	DROP INDEX uq_patients_hospital_hn;
+	UPDATE patients p SET patient_hn = h.code FROM hospitals h WHERE h.id = p.hospital_id;
+	CREATE INDEX idx_patients_patient_hn ON patients(patient_hn);
+	ALTER TABLE patients DROP COLUMN hospital_id;
+
+	ALTER TABLE staff ADD COLUMN hospital VARCHAR(255);
+	UPDATE staff s SET hospital = h.code FROM hospitals h WHERE h.id = s.hospital_id;
+	ALTER TABLE staff ALTER COLUMN hospital SET NOT NULL;
+	ALTER TABLE staff DROP COLUMN hospital_id;
+	CREATE INDEX idx_staff_hospital ON staff(hospital);
+
+	DROP TABLE hospitals;
+`
+)
+
+var migration0008Hospitals = &Migration{
+	Number: 8,
+	Name:   "Add hospitals and per-hospital patient numbers",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0008Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Hospitals table created and patients migrated successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0008Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Hospitals table dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0008Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0008Hospitals)
+}
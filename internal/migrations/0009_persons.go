@@ -0,0 +1,195 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0009Forwards = `
+	CREATE TABLE persons (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		first_name_th VARCHAR(255),
+		middle_name_th VARCHAR(255),
+		last_name_th VARCHAR(255),
+		first_name_en VARCHAR(255),
+		middle_name_en VARCHAR(255),
+		last_name_en VARCHAR(255),
+		date_of_birth DATE,
+		national_id VARCHAR(13),
+		passport_id VARCHAR(20),
+		phone_number VARCHAR(20),
+		email VARCHAR(255),
+		gender gender_enum,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE
+	);
+
+	-- Registrations sharing a national ID, or a passport when there is no
+	-- national ID, are the same person. The most recently changed live
+	-- registration provides the person's details.
+	ALTER TABLE patients ADD COLUMN person_id UUID;
+
+	UPDATE patients p SET person_id = grouped.person_id
+	FROM (
+		SELECT id, first_value(id) OVER (
+			PARTITION BY COALESCE('cid:' || national_id, 'ppn:' || passport_id, 'id:' || id::text)
+			ORDER BY deleted_at IS NOT NULL, COALESCE(updated_at, created_at) DESC, id
+		) AS person_id
+		FROM patients
+	) grouped
+	WHERE grouped.id = p.id;
+
+	-- Passports and emails were only unique among live registrations, so
+	-- a deleted one may repeat a value in use elsewhere. Such duplicates
+	-- are kept on the live person only.
+	INSERT INTO persons (
+		id, first_name_th, middle_name_th, last_name_th, first_name_en, middle_name_en, last_name_en,
+		date_of_birth, national_id, passport_id, phone_number, email, gender, created_at, updated_at
+	)
+	SELECT
+		p.id, p.first_name_th, p.middle_name_th, p.last_name_th, p.first_name_en, p.middle_name_en, p.last_name_en,
+		p.date_of_birth, p.national_id,
+		CASE WHEN row_number() OVER (PARTITION BY p.passport_id ORDER BY p.deleted_at IS NOT NULL, p.created_at) = 1 THEN p.passport_id END,
+		p.phone_number,
+		CASE WHEN row_number() OVER (PARTITION BY p.email ORDER BY p.deleted_at IS NOT NULL, p.created_at) = 1 THEN p.email END,
+		p.gender,
+		(SELECT MIN(r.created_at) FROM patients r WHERE r.person_id = p.id),
+		p.updated_at
+	FROM patients p
+	WHERE p.id = p.person_id;
+
+	ALTER TABLE patients ALTER COLUMN person_id SET NOT NULL;
+	ALTER TABLE patients ADD CONSTRAINT patients_person_id_fkey FOREIGN KEY (person_id) REFERENCES persons(id);
+
+	-- patients now only holds the registration of a person at a hospital.
+	-- Dropping the columns also drops their unique and trigram indexes.
+	ALTER TABLE patients DROP CONSTRAINT chk_patients_identifier;
+	ALTER TABLE patients
+		DROP COLUMN first_name_th,
+		DROP COLUMN middle_name_th,
+		DROP COLUMN last_name_th,
+		DROP COLUMN first_name_en,
+		DROP COLUMN middle_name_en,
+		DROP COLUMN last_name_en,
+		DROP COLUMN date_of_birth,
+		DROP COLUMN national_id,
+		DROP COLUMN passport_id,
+		DROP COLUMN phone_number,
+		DROP COLUMN email,
+		DROP COLUMN gender;
+
+	CREATE UNIQUE INDEX uq_patients_person_hospital ON patients(person_id, hospital_id) WHERE deleted_at IS NULL;
+
+	CREATE UNIQUE INDEX uq_persons_national_id ON persons(national_id);
+	CREATE UNIQUE INDEX uq_persons_passport_id ON persons(passport_id);
+	CREATE UNIQUE INDEX uq_persons_email ON persons(email);
+
+	ALTER TABLE persons ADD CONSTRAINT chk_persons_identifier
+		CHECK (national_id IS NOT NULL OR passport_id IS NOT NULL) NOT VALID;
+
+	CREATE INDEX idx_persons_first_name_th_trgm ON persons USING GIN (first_name_th gin_trgm_ops);
+	CREATE INDEX idx_persons_middle_name_th_trgm ON persons USING GIN (middle_name_th gin_trgm_ops);
+	CREATE INDEX idx_persons_last_name_th_trgm ON persons USING GIN (last_name_th gin_trgm_ops);
+	CREATE INDEX idx_persons_first_name_en_trgm ON persons USING GIN (first_name_en gin_trgm_ops);
+	CREATE INDEX idx_persons_middle_name_en_trgm ON persons USING GIN (middle_name_en gin_trgm_ops);
+	CREATE INDEX idx_persons_last_name_en_trgm ON persons USING GIN (last_name_en gin_trgm_ops);
+`
+
+	migration0009Backwards = `
+	-- Without persons a national ID, passport or email can belong to
+	-- only one live registration.
+	DO $$
+	BEGIN
+		IF EXISTS (
+			SELECT 1 FROM patients WHERE deleted_at IS NULL
+			GROUP BY person_id HAVING COUNT(*) > 1
+		) THEN
+			RAISE EXCEPTION 'persons registered at more than one hospital cannot be rolled back';
+		END IF;
+	END;
+	$$;
+
+	ALTER TABLE patients
+		ADD COLUMN first_name_th VARCHAR(255),
+		ADD COLUMN middle_name_th VARCHAR(255),
+		ADD COLUMN last_name_th VARCHAR(255),
+		ADD COLUMN first_name_en VARCHAR(255),
+		ADD COLUMN middle_name_en VARCHAR(255),
+		ADD COLUMN last_name_en VARCHAR(255),
+		ADD COLUMN date_of_birth DATE,
+		ADD COLUMN national_id VARCHAR(13),
+		ADD COLUMN passport_id VARCHAR(20),
+		ADD COLUMN phone_number VARCHAR(20),
+		ADD COLUMN email VARCHAR(255),
+		ADD COLUMN gender gender_enum;
+
+	UPDATE patients r SET
+		first_name_th = p.first_name_th,
+		middle_name_th = p.middle_name_th,
+		last_name_th = p.last_name_th,
+		first_name_en = p.first_name_en,
+		middle_name_en = p.middle_name_en,
+		last_name_en = p.last_name_en,
+		date_of_birth = p.date_of_birth,
+		national_id = p.national_id,
+		passport_id = p.passport_id,
+		phone_number = p.phone_number,
+		email = p.email,
+		gender = p.gender
+	FROM persons p
+	WHERE p.id = r.person_id;
+
+	DROP INDEX uq_patients_person_hospital;
+	ALTER TABLE patients DROP COLUMN person_id;
+	DROP TABLE persons;
+
+	CREATE UNIQUE INDEX uq_patients_national_id ON patients(national_id) WHERE deleted_at IS NULL;
+	CREATE UNIQUE INDEX uq_patients_passport_id ON patients(passport_id) WHERE deleted_at IS NULL;
+	CREATE UNIQUE INDEX uq_patients_email ON patients(email) WHERE deleted_at IS NULL;
+
+	ALTER TABLE patients ADD CONSTRAINT chk_patients_identifier
+		CHECK (national_id IS NOT NULL OR passport_id IS NOT NULL) NOT VALID;
+
+	CREATE INDEX idx_patients_first_name_th_trgm ON patients USING GIN (first_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_middle_name_th_trgm ON patients USING GIN (middle_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_last_name_th_trgm ON patients USING GIN (last_name_th gin_trgm_ops);
+	CREATE INDEX idx_patients_first_name_en_trgm ON patients USING GIN (first_name_en gin_trgm_ops);
+	CREATE INDEX idx_patients_middle_name_en_trgm ON patients USING GIN (middle_name_en gin_trgm_ops);
+	CREATE INDEX idx_patients_last_name_en_trgm ON patients USING GIN (last_name_en gin_trgm_ops);
+`
+)
+
+var migration0009Persons = &Migration{
+	Number: 9,
+	Name:   "Split patients into persons and hospital registrations",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0009Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Persons table created and patients migrated successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0009Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Persons table dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0009Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0009Persons)
+}
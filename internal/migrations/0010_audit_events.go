@@ -0,0 +1,131 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migration0010Forwards = `
+	CREATE TABLE audit_events (
+		seq BIGINT PRIMARY KEY,
+		occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		staff_id UUID REFERENCES staff(id),
+		hospital_id UUID REFERENCES hospitals(id),
+		action VARCHAR(64) NOT NULL,
+		patient_ids UUID[] NOT NULL DEFAULT '{}',
+		target_staff_id UUID REFERENCES staff(id),
+		filters JSONB NOT NULL DEFAULT '{}',
+		request_id VARCHAR(64),
+		ip_address INET,
+		prev_hash CHAR(64) NOT NULL,
+		hash CHAR(64) NOT NULL
+	);
+
+	CREATE INDEX idx_audit_events_hospital_occurred_at ON audit_events(hospital_id, occurred_at);
+	CREATE INDEX idx_audit_events_staff_id ON audit_events(staff_id);
+	CREATE INDEX idx_audit_events_patient_ids ON audit_events USING GIN (patient_ids);
+
+	-- The hash covers every column of the event and the hash of the
+	-- event before it, so changing or removing any event breaks the
+	-- chain from that point on.
+	CREATE FUNCTION audit_event_hash(e audit_events) RETURNS TEXT AS $$
+		SELECT encode(sha256(convert_to(concat_ws('|',
+			e.seq,
+			e.prev_hash,
+			to_char(e.occurred_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+			COALESCE(e.staff_id::text, ''),
+			COALESCE(e.hospital_id::text, ''),
+			e.action,
+			array_to_string(e.patient_ids, ','),
+			COALESCE(e.target_staff_id::text, ''),
+			e.filters::text,
+			COALESCE(e.request_id, ''),
+			COALESCE(host(e.ip_address), '')
+		), 'UTF8')), 'hex');
+	$$ LANGUAGE sql STABLE;
+
+	-- Events are chained one at a time: the lock is held until the
+	-- inserting transaction ends, so seq has no gaps and each event
+	-- links to the one committed before it.
+	CREATE FUNCTION audit_events_chain() RETURNS TRIGGER AS $$
+	DECLARE
+		previous audit_events%ROWTYPE;
+	BEGIN
+		PERFORM pg_advisory_xact_lock(hashtext('audit_events'));
+
+		SELECT * INTO previous FROM audit_events ORDER BY seq DESC LIMIT 1;
+
+		NEW.seq := COALESCE(previous.seq, 0) + 1;
+		NEW.occurred_at := clock_timestamp();
+		NEW.prev_hash := COALESCE(previous.hash, repeat('0', 64));
+		NEW.hash := audit_event_hash(NEW);
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE FUNCTION audit_events_immutable() RETURNS TRIGGER AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_events is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER trg_audit_events_chain BEFORE INSERT ON audit_events
+		FOR EACH ROW EXECUTE FUNCTION audit_events_chain();
+	CREATE TRIGGER trg_audit_events_immutable BEFORE UPDATE OR DELETE ON audit_events
+		FOR EACH ROW EXECUTE FUNCTION audit_events_immutable();
+	CREATE TRIGGER trg_audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_events_immutable();
+`
+
+	migration0010Backwards = `
+	-- The audit trail is append-only, so it can only be dropped before
+	-- anything has been recorded.
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM audit_events) THEN
+			RAISE EXCEPTION 'audit_events is not empty';
+		END IF;
+	END;
+	$$;
+
+	DROP FUNCTION audit_event_hash(audit_events);
+	DROP TABLE audit_events;
+	DROP FUNCTION audit_events_chain();
+	DROP FUNCTION audit_events_immutable();
+`
+)
+
+var migration0010AuditEvents = &Migration{
+	Number: 10,
+	Name:   "Create hash-chained audit trail",
+	Forwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0010Forwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Audit trail created successfully")
+		return nil
+	},
+	Backwards: func(tx pgx.Tx, logger *slog.Logger) error {
+		ctx := context.Background()
+
+		_, err := tx.Exec(ctx, migration0010Backwards)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Audit events table dropped successfully")
+		return nil
+	},
+	checksum: checksum([]byte(migration0010Forwards)),
+}
+
+func init() {
+	Migrations = append(Migrations, migration0010AuditEvents)
+}
@@ -0,0 +1,163 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// resetEnvironments may reset the schema without confirmation.
+var resetEnvironments = []string{"dev", "test"}
+
+// checkReset refuses a forced reset outside dev and test unless confirm names
+// the database being reset.
+func checkReset(environment string, database string, confirm string) error {
+	if slices.Contains(resetEnvironments, environment) {
+		return nil
+	}
+	if confirm == "" {
+		return fmt.Errorf("refusing to force migrate database %q in the %q environment; rerun with --confirm %s to drop all its data", database, environment, database)
+	}
+	if confirm != database {
+		return fmt.Errorf("refusing to force migrate database %q: --confirm %q does not match the database name", database, confirm)
+	}
+	return nil
+}
+
+// backup writes the data of every table in the public schema to a file in
+// dir, as COPY blocks that psql can load back into a schema migrated to the
+// same version, and returns the file's path. Restoring replaces the rows
+// migrations inserted and sets the sequences to their backed up values. It
+// returns an empty path if there are no tables.
+func backup(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger, dir string, database string) (string, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to acquire connection for backup: %w", err)
+	}
+	defer conn.Release()
+
+	// The bookkeeping table is left out; migrating the new schema fills it.
+	rows, err := conn.Query(ctx, `
+		SELECT c.table_name, array_agg(c.column_name::text ORDER BY c.ordinal_position)
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE' AND c.table_name <> 'migrations'
+		GROUP BY c.table_name
+		ORDER BY c.table_name
+	`)
+	if err != nil {
+		return "", fmt.Errorf("unable to list tables for backup: %w", err)
+	}
+	type table struct {
+		name    string
+		columns []string
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (table, error) {
+		var t table
+		err := row.Scan(&t.name, &t.columns)
+		return t, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list tables for backup: %w", err)
+	}
+	if len(tables) == 0 {
+		logger.Info("no tables to back up")
+		return "", nil
+	}
+
+	// Sequences owned by a column, such as those of SERIAL keys. One that
+	// was never used has no last value and restarts from its start value.
+	rows, err = conn.Query(ctx, `
+		SELECT s.sequencename, COALESCE(s.last_value, s.start_value), s.last_value IS NOT NULL
+		FROM pg_sequences s
+		JOIN pg_class c ON c.relname = s.sequencename AND c.relnamespace = 'public'::regnamespace
+		WHERE s.schemaname = 'public' AND EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('a', 'i')
+		)
+		ORDER BY s.sequencename
+	`)
+	if err != nil {
+		return "", fmt.Errorf("unable to list sequences for backup: %w", err)
+	}
+	type sequence struct {
+		name   string
+		value  int64
+		called bool
+	}
+	sequences, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (sequence, error) {
+		var s sequence
+		err := row.Scan(&s.name, &s.value, &s.called)
+		return s, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list sequences for backup: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("unable to create backup directory: %w", err)
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.sql", database, now.Format("20060102T150405Z")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("unable to create backup file: %w", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "-- Data of database %s, backed up by migrate-db before a forced reset at %s.\n", database, now.Format(time.RFC3339))
+	fmt.Fprintf(w, "-- Restore into a schema migrated to the same version with: psql -v ON_ERROR_STOP=1 -d %s -f %s\n", database, filepath.Base(path))
+	fmt.Fprintf(w, "-- The tables are emptied first, so rows the migrations inserted are replaced by the backed up ones.\n")
+	fmt.Fprintf(w, "-- Triggers and foreign keys are not enforced while loading, so tables load in any order. This sets\n")
+	fmt.Fprintf(w, "-- session_replication_role, which needs a superuser, or on PostgreSQL 15 and later a role granted SET on it.\n\n")
+	fmt.Fprintf(w, "SET session_replication_role = replica;\n\n")
+
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = pgx.Identifier{"public", t.name}.Sanitize()
+	}
+	fmt.Fprintf(w, "TRUNCATE %s CASCADE;\n\n", strings.Join(names, ", "))
+
+	for _, t := range tables {
+		columns := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			columns[i] = pgx.Identifier{column}.Sanitize()
+		}
+		target := fmt.Sprintf("%s (%s)", pgx.Identifier{"public", t.name}.Sanitize(), strings.Join(columns, ", "))
+
+		fmt.Fprintf(w, "COPY %s FROM stdin;\n", target)
+		tag, err := conn.Conn().PgConn().CopyTo(ctx, w, fmt.Sprintf("COPY %s TO STDOUT", target))
+		if err != nil {
+			return "", fmt.Errorf("unable to back up table %s: %w", t.name, err)
+		}
+		fmt.Fprintf(w, "\\.\n\n")
+		logger.Debug("backed up table", "table", t.name, "rows", tag.RowsAffected())
+	}
+
+	for _, s := range sequences {
+		name := strings.ReplaceAll(pgx.Identifier{"public", s.name}.Sanitize(), "'", "''")
+		fmt.Fprintf(w, "SELECT pg_catalog.setval('%s', %d, %t);\n", name, s.value, s.called)
+	}
+	if len(sequences) > 0 {
+		fmt.Fprintf(w, "\n")
+	}
+
+	fmt.Fprintf(w, "RESET session_replication_role;\n")
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("unable to write backup file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return "", fmt.Errorf("unable to write backup file: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,120 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReset(t *testing.T) {
+	assert.NoError(t, checkReset("dev", "hospital_db", ""))
+	assert.NoError(t, checkReset("test", "hospital_db", ""))
+	assert.NoError(t, checkReset("production", "hospital_db", "hospital_db"))
+
+	assert.ErrorContains(t, checkReset("production", "hospital_db", ""), "--confirm hospital_db")
+	assert.ErrorContains(t, checkReset("demo", "hospital_db", ""), "refusing")
+	assert.ErrorContains(t, checkReset("production", "hospital_db", "other_db"), "does not match")
+}
+
+func TestBackup(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	// The migrations table is left out of backups.
+	require.NoError(t, ensureMigrationsTable(ctx, pool, logger))
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE backup_test_items (id INT PRIMARY KEY, name TEXT, note TEXT);
+		INSERT INTO backup_test_items VALUES (1, 'Somchai', E'two\nlines'), (2, 'Somsri', NULL);
+	`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP TABLE backup_test_items")
+	})
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	path, err := backup(ctx, pool, logger, dir, "hospital_test")
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.Regexp(t, `^hospital_test-\d{8}T\d{6}Z\.sql$`, filepath.Base(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	dump := string(data)
+	assert.Contains(t, dump, "SET session_replication_role = replica;")
+	assert.Regexp(t, `TRUNCATE [^;]*"public"\."backup_test_items"[^;]* CASCADE;`, dump)
+	assert.Contains(t, dump, "COPY \"public\".\"backup_test_items\" (\"id\", \"name\", \"note\") FROM stdin;\n"+
+		"1\tSomchai\ttwo\\nlines\n"+
+		"2\tSomsri\t\\N\n"+
+		"\\.\n")
+	assert.NotContains(t, dump, `"public"."migrations"`)
+}
+
+func TestBackupRestore(t *testing.T) {
+	pool := testPool(t)
+	psql, err := exec.LookPath("psql")
+	if err != nil {
+		t.Skip("psql is not installed")
+	}
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	migrateTestSchema(t, pool)
+	_, err = pool.Exec(ctx, `
+		INSERT INTO hospitals (code, name) VALUES ('hn-001', 'Hospital 1');
+		INSERT INTO roles (name, description) VALUES ('nurse', 'Reads patient records');
+		INSERT INTO staff (username, password_hash, hospital_id) SELECT 'somchai', 'hash', id FROM hospitals;
+		INSERT INTO persons (first_name_en, national_id) VALUES ('Somchai', '1234567890121');
+		INSERT INTO patients (person_id, hospital_id) SELECT p.id, h.id FROM persons p, hospitals h;
+		INSERT INTO audit_events (staff_id, hospital_id, action) SELECT id, hospital_id, 'patient.read' FROM staff;
+	`)
+	require.NoError(t, err)
+
+	path, err := backup(ctx, pool, logger, t.TempDir(), "hospital_test")
+	require.NoError(t, err)
+
+	// Restore into a freshly migrated schema, which already holds the roles
+	// and permissions migration 4 inserted.
+	migrateTestSchema(t, pool)
+	output, err := exec.CommandContext(ctx, psql, "-v", "ON_ERROR_STOP=1", "-d", os.Getenv("TEST_DATABASE_URL"), "-f", path).CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	var roles, staff, patients int
+	require.NoError(t, pool.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM roles), (SELECT COUNT(*) FROM staff), (SELECT COUNT(*) FROM patients)
+	`).Scan(&roles, &staff, &patients))
+	assert.Equal(t, 5, roles)
+	assert.Equal(t, 1, staff)
+	assert.Equal(t, 1, patients)
+
+	// The audit chain is restored as it was and continues from it.
+	var broken int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*) FROM audit_events e WHERE e.hash <> audit_event_hash(e)").Scan(&broken))
+	assert.Zero(t, broken)
+	var seq int64
+	require.NoError(t, pool.QueryRow(ctx, `
+		INSERT INTO audit_events (action) VALUES ('audit.verify') RETURNING seq
+	`).Scan(&seq))
+	assert.Equal(t, int64(2), seq)
+
+	// Sequences and counters carry on after the restored rows.
+	var roleID int
+	require.NoError(t, pool.QueryRow(ctx, "INSERT INTO roles (name) VALUES ('pharmacist') RETURNING id").Scan(&roleID))
+	assert.Equal(t, 6, roleID)
+	var hn string
+	require.NoError(t, pool.QueryRow(ctx, `
+		WITH person AS (INSERT INTO persons (first_name_en, national_id) VALUES ('Somsri', '1234567890130') RETURNING id)
+		INSERT INTO patients (person_id, hospital_id) SELECT person.id, hospitals.id FROM person, hospitals RETURNING patient_hn
+	`).Scan(&hn))
+	assert.Equal(t, "HN00000002", hn)
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Checksum identifies the forwards step of the migration by the SQL it runs:
+// the up file of a SQL migration, or the statements of a Go migration. Edits
+// to the Go code around those statements, such as its logging, or to
+// Backwards do not change it.
+func (m *Migration) Checksum() string {
+	return m.checksum
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChecksums compares the checksums recorded for applied migrations with
+// those of this build. Migrations applied before checksums were recorded get
+// theirs recorded now. Changed migrations are an error unless allowDrift is
+// set, in which case the new checksums are recorded.
+func verifyChecksums(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger, dryRun bool, allowDrift bool) error {
+	applied, err := appliedMigrations(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	byNumber := make(map[uint]*Migration, len(Migrations))
+	for _, migration := range Migrations {
+		byNumber[migration.Number] = migration
+	}
+
+	var changed []string
+	updates := make(map[uint]string)
+	for _, record := range applied {
+		migration, ok := byNumber[record.number]
+		if !ok {
+			continue
+		}
+		current := migration.Checksum()
+
+		if record.checksum == nil {
+			updates[record.number] = current
+			continue
+		}
+		if *record.checksum != current {
+			changed = append(changed, fmt.Sprintf("%d (%q)", record.number, migration.Name))
+			if allowDrift {
+				updates[record.number] = current
+			}
+		}
+	}
+
+	if len(changed) > 0 {
+		if !allowDrift {
+			err := fmt.Errorf("applied migrations have changed since they were applied: %s; rerun with --allow-drift to accept them", strings.Join(changed, ", "))
+			logger.Error("Unable to apply migrations", "error", err)
+			return err
+		}
+		logger.Warn("applied migrations have changed since they were applied, accepting their new checksums", "migrations", strings.Join(changed, ", "))
+	}
+
+	if dryRun || len(updates) == 0 {
+		return nil
+	}
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		for number, checksum := range updates {
+			if _, err := tx.Exec(ctx, "UPDATE migrations SET checksum = $1 WHERE number = $2", checksum, number); err != nil {
+				return fmt.Errorf("unable to record migration checksum: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	t.Run("Every Migration", func(t *testing.T) {
+		for _, migration := range Migrations {
+			assert.Len(t, migration.Checksum(), 64, "migration %d", migration.Number)
+			assert.NoError(t, migration.validate())
+		}
+	})
+
+	t.Run("Go Migration", func(t *testing.T) {
+		assert.Equal(t, checksum([]byte(migration0001Forwards)), migration0001InitialSchema.Checksum())
+
+		edited := strings.Replace(migration0001Forwards, "username VARCHAR(255)", "username TEXT", 1)
+		assert.NotEqual(t, migration0001InitialSchema.Checksum(), checksum([]byte(edited)))
+	})
+
+	t.Run("SQL Migration", func(t *testing.T) {
+		load := func(up string) string {
+			migrations, err := loadSQLMigrations(fstest.MapFS{"0011_add_visit_notes.up.sql": {Data: []byte(up)}})
+			require.NoError(t, err)
+			return migrations[0].Checksum()
+		}
+
+		original := load("CREATE TABLE visit_notes (id UUID);")
+		assert.Equal(t, checksum([]byte("CREATE TABLE visit_notes (id UUID);")), original)
+		assert.NotEqual(t, original, load("CREATE TABLE visit_notes (id BIGINT);"))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		migration := &Migration{Number: 12, Forwards: migration0001InitialSchema.Forwards}
+		assert.ErrorContains(t, migration.validate(), "migration 12 has no checksum")
+	})
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	require.NoError(t, ensureMigrationsTable(ctx, pool, logger))
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DELETE FROM migrations WHERE number IN (1, 3)")
+	})
+
+	// Migration 1 was applied with an edited statement, and migration 3
+	// before checksums were recorded.
+	edited := strings.Replace(migration0001Forwards, "username VARCHAR(255)", "username TEXT", 1)
+	_, err := pool.Exec(ctx, `
+		INSERT INTO migrations (number, name, checksum) VALUES (1, 'Create initial schema', $1), (3, 'Add refresh tokens and token revocation', NULL)
+	`, checksum([]byte(edited)))
+	require.NoError(t, err)
+
+	recorded := func() map[uint]*string {
+		applied, err := appliedMigrations(ctx, pool)
+		require.NoError(t, err)
+		checksums := make(map[uint]*string)
+		for _, record := range applied {
+			checksums[record.number] = record.checksum
+		}
+		return checksums
+	}
+
+	t.Run("Drift", func(t *testing.T) {
+		err := verifyChecksums(ctx, pool, logger, false, false)
+		assert.ErrorContains(t, err, `applied migrations have changed since they were applied: 1 ("Create initial schema")`)
+		assert.Nil(t, recorded()[3])
+	})
+
+	t.Run("Allow Drift", func(t *testing.T) {
+		require.NoError(t, verifyChecksums(ctx, pool, logger, false, true))
+
+		checksums := recorded()
+		require.NotNil(t, checksums[1])
+		assert.Equal(t, migration0001InitialSchema.Checksum(), *checksums[1])
+		require.NotNil(t, checksums[3])
+		assert.Equal(t, migration0003StaffSessions.Checksum(), *checksums[3])
+
+		assert.NoError(t, verifyChecksums(ctx, pool, logger, false, false))
+	})
+}
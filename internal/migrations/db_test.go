@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// testPool connects to the Postgres database named by TEST_DATABASE_URL, and
+// skips the test if it is not set. Tests may create and drop tables in it, so
+// it must not hold data worth keeping.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	require.NoError(t, pool.Ping(context.Background()))
+	return pool
+}
+
+// migrateTestSchema replaces the public schema of the test database with one
+// that has every migration applied, and empties it again when the test ends.
+func migrateTestSchema(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	reset := func() error {
+		_, err := pool.Exec(context.Background(), "DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+		return err
+	}
+	require.NoError(t, reset())
+	t.Cleanup(func() {
+		reset()
+	})
+
+	require.NoError(t, sortMigrations(logger))
+	require.NoError(t, ensureMigrationsTable(ctx, pool, logger))
+	for _, migration := range Migrations {
+		require.NoError(t, apply(ctx, pool, logger, migration, true), "migration %d", migration.Number)
+	}
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockName identifies the advisory lock serialising migration runs.
+const lockName = "migrations"
+
+const lockPollInterval = time.Second
+
+// acquireLock takes the session-level migration advisory lock on a connection
+// of its own, waiting up to timeout while another instance holds it. The
+// returned func releases the lock and the connection; the lock is also
+// released by Postgres if the connection is lost.
+func acquireLock(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger, timeout time.Duration) (func(), error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire connection for migration lock: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waited := false
+	for {
+		var locked bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", lockName).Scan(&locked); err != nil {
+			conn.Release()
+			return nil, fmt.Errorf("unable to acquire migration lock: %w", err)
+		}
+		if locked {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			conn.Release()
+			return nil, fmt.Errorf("timed out after %s waiting for the migration lock held by another instance", timeout)
+		}
+		if !waited {
+			logger.Info("another instance is running migrations, waiting for the migration lock", "timeout", timeout)
+			waited = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	if waited {
+		logger.Info("migration lock acquired")
+	} else {
+		logger.Debug("migration lock acquired")
+	}
+
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", lockName); err != nil {
+			logger.Warn("unable to release migration lock", "error", err)
+		}
+		conn.Release()
+	}, nil
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	logger := slog.New(slog.DiscardHandler)
+
+	unlock, err := acquireLock(ctx, pool, logger, time.Second)
+	require.NoError(t, err)
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		other, err := acquireLock(ctx, pool, logger, 2*lockPollInterval)
+		assert.ErrorContains(t, err, "timed out after 2s waiting for the migration lock")
+		assert.Nil(t, other)
+		assert.GreaterOrEqual(t, time.Since(start), 2*lockPollInterval)
+	})
+
+	t.Run("Released", func(t *testing.T) {
+		unlock()
+		again, err := acquireLock(ctx, pool, logger, 0)
+		require.NoError(t, err)
+		again()
+	})
+}
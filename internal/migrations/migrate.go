@@ -3,110 +3,159 @@ package migrations
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sort"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-const batchSize = 1000
-
+// Migration is a numbered schema change. Forwards runs in the same
+// transaction that records the migration, so a failing migration leaves
+// neither schema changes nor a migrations row behind.
 type Migration struct {
-	Number   uint                                                `json:"number"`
-	Name     string                                              `json:"name"`
-	Forwards func(db *pgxpool.Pool, logger *logrus.Logger) error `json:"-"`
+	Number   uint                                       `json:"number"`
+	Name     string                                     `json:"name"`
+	Forwards func(tx pgx.Tx, logger *slog.Logger) error `json:"-"`
+	// Backwards reverts Forwards. Migrations without it cannot be rolled back.
+	Backwards func(tx pgx.Tx, logger *slog.Logger) error `json:"-"`
+
+	// NoTransaction opts out of the transaction for statements that cannot
+	// run inside one, such as CREATE INDEX CONCURRENTLY. Such migrations set
+	// ForwardsNoTx and BackwardsNoTx instead, and are recorded only once they
+	// have completed, so they must be safe to run again after a failure.
+	NoTransaction bool                                              `json:"no_transaction"`
+	ForwardsNoTx  func(db *pgxpool.Pool, logger *slog.Logger) error `json:"-"`
+	BackwardsNoTx func(db *pgxpool.Pool, logger *slog.Logger) error `json:"-"`
+
+	// checksum is the SHA-256 of the SQL the forwards step runs: the up file
+	// of a SQL migration, or the constant a Go migration executes.
+	checksum string
+}
+
+// reversible reports whether the migration can be rolled back.
+func (m *Migration) reversible() bool {
+	if m.NoTransaction {
+		return m.BackwardsNoTx != nil
+	}
+	return m.Backwards != nil
+}
+
+// validate checks the migration sets the steps matching NoTransaction and
+// has a checksum.
+func (m *Migration) validate() error {
+	if m.checksum == "" {
+		return fmt.Errorf("migration %d has no checksum of the SQL its forwards step runs", m.Number)
+	}
+	if m.NoTransaction {
+		if m.ForwardsNoTx == nil || m.Forwards != nil || m.Backwards != nil {
+			return fmt.Errorf("migration %d runs without a transaction and must only set ForwardsNoTx and BackwardsNoTx", m.Number)
+		}
+		return nil
+	}
+	if m.Forwards == nil || m.ForwardsNoTx != nil || m.BackwardsNoTx != nil {
+		return fmt.Errorf("migration %d must only set Forwards and Backwards", m.Number)
+	}
+	return nil
 }
 
 var Migrations []*Migration
 
-func Migrate(logger *logrus.Logger, dryRun bool, number int, forceMigrate bool) error {
-	if dryRun {
-		logger.Infof("=== DRY RUN ===")
+// Migrate brings the database to migration number to, running migrations
+// forwards or backwards as needed. A number of -1 runs all migrations.
+// Applied migrations that have changed since are an error unless allowDrift
+// is set. forceMigrate drops the schema first, after backing up its data; it
+// is refused outside dev and test unless confirmDatabase names the database.
+func Migrate(logger *slog.Logger, dryRun bool, to int, forceMigrate bool, confirmDatabase string, allowDrift bool) error {
+	if to < -1 {
+		return fmt.Errorf("invalid migration number: %d", to)
 	}
 
-	// Check for duplicate migration numbers
-	migrationIDs := make(map[uint]struct{})
-	for _, migration := range Migrations {
-		if _, ok := migrationIDs[migration.Number]; ok {
-			err := fmt.Errorf("duplicate migration number found: %d", migration.Number)
-			logger.Errorf("Unable to apply migrations, err: %+v", err)
+	if forceMigrate {
+		if err := checkReset(viper.GetString("App.Environment"), viper.GetString("Database.Name"), confirmDatabase); err != nil {
+			logger.Error("Unable to apply migrations", "error", err)
 			return err
 		}
-		migrationIDs[migration.Number] = struct{}{}
 	}
 
-	// Sort migrations by number
-	sort.Slice(Migrations, func(i, j int) bool {
-		return Migrations[i].Number < Migrations[j].Number
-	})
+	if dryRun {
+		logger.Info("=== DRY RUN ===")
+	}
 
-	// Connect to database
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		viper.GetString("Database.Host"),
-		viper.GetInt("Database.Port"),
-		viper.GetString("Database.User"),
-		viper.GetString("Database.Password"),
-		viper.GetString("Database.Name"),
-	)
+	if err := sortMigrations(logger); err != nil {
+		return err
+	}
 
 	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, dsn)
+	pool, err := connect(ctx)
 	if err != nil {
-		return fmt.Errorf("unable to connect to database: %w", err)
+		return err
 	}
 	defer pool.Close()
 
-	// Force migrate - drop and recreate schema
+	// Only one instance may read and change the migration state at a time.
+	unlock, err := acquireLock(ctx, pool, logger, viper.GetDuration("Migrations.LockTimeout"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Force migrate - back up the data, then drop and recreate schema
 	if forceMigrate {
-		logger.Infof("=== FORCE MIGRATE ===")
-		if _, err := pool.Exec(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public;"); err != nil {
-			return fmt.Errorf("unable to reset schema: %w", err)
+		logger.Info("=== FORCE MIGRATE ===")
+		if dryRun {
+			logger.Info("skipping backup and schema reset in dry run")
+		} else {
+			path, err := backup(ctx, pool, logger, viper.GetString("Migrations.BackupDir"), viper.GetString("Database.Name"))
+			if err != nil {
+				return err
+			}
+			if path != "" {
+				logger.Info("backed up data", "path", path)
+			}
+
+			if _, err := pool.Exec(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public;"); err != nil {
+				return fmt.Errorf("unable to reset schema: %w", err)
+			}
 		}
 	}
 
-	// Create migrations table if not exists
-	logger.Debugf("ensuring migrations table is present")
-	createTableSQL := `
-		CREATE TABLE IF NOT EXISTS migrations (
-			number BIGINT PRIMARY KEY,
-			name TEXT NOT NULL,
-			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		)
-	`
-	if _, err := pool.Exec(ctx, createTableSQL); err != nil {
-		return fmt.Errorf("unable to create migrations table: %w", err)
+	latestNumber, err := latestMigration(ctx, pool, logger)
+	if err != nil {
+		return err
 	}
 
-	// Get latest migration
-	var latestNumber uint
-	err = pool.QueryRow(ctx, "SELECT COALESCE(MAX(number), 0) FROM migrations").Scan(&latestNumber)
-	if err != nil {
-		return fmt.Errorf("unable to find latest migration: %w", err)
+	if err := verifyChecksums(ctx, pool, logger, dryRun, allowDrift); err != nil {
+		return err
+	}
+
+	if to >= 0 && uint(to) < latestNumber {
+		return rollback(ctx, pool, logger, dryRun, to)
 	}
 
 	if len(Migrations) == 0 {
-		logger.Infof("no migrations to apply")
+		logger.Info("no migrations to apply")
 		return nil
 	}
 
 	if latestNumber >= Migrations[len(Migrations)-1].Number {
-		logger.Infof("no migrations to apply - database is up to date")
+		logger.Info("no migrations to apply - database is up to date")
 		return nil
 	}
 
-	if number == -1 {
-		number = int(Migrations[len(Migrations)-1].Number)
+	if to == -1 {
+		to = int(Migrations[len(Migrations)-1].Number)
 	}
 
-	if uint(number) <= latestNumber && latestNumber > 0 {
-		logger.Infof("no migrations to apply, specified number is less than or equal to latest migration")
+	if uint(to) <= latestNumber && latestNumber > 0 {
+		logger.Info("no migrations to apply, specified number is equal to latest migration")
 		return nil
 	}
 
 	// Apply migrations
 	for _, migration := range Migrations {
-		if migration.Number > uint(number) {
+		if migration.Number > uint(to) {
 			break
 		}
 
@@ -114,45 +163,240 @@ func Migrate(logger *logrus.Logger, dryRun bool, number int, forceMigrate bool)
 			continue
 		}
 
-		migLogger := logger.WithFields(logrus.Fields{
-			"migration_number": migration.Number,
-			"migration_name":   migration.Name,
-		})
-		migLogger.Infof("applying migration %d: %q", migration.Number, migration.Name)
+		migLogger := logger.With(
+			slog.Uint64("migration_number", uint64(migration.Number)),
+			slog.String("migration_name", migration.Name),
+		)
+		migLogger.Info("applying migration")
+
+		if dryRun {
+			continue
+		}
+
+		if err := apply(ctx, pool, logger, migration, true); err != nil {
+			migLogger.Error("unable to apply migration, rolling back", "error", err)
+			return err
+		}
+
+		migLogger.Info("migration applied successfully")
+	}
+
+	logger.Info("all migrations applied successfully")
+	return nil
+}
+
+// Rollback reverts applied migrations above number to, latest first. A number
+// of -1 reverts only the latest applied migration.
+func Rollback(logger *slog.Logger, dryRun bool, to int, allowDrift bool) error {
+	if to < -1 {
+		return fmt.Errorf("invalid migration number: %d", to)
+	}
+
+	if dryRun {
+		logger.Info("=== DRY RUN ===")
+	}
+
+	if err := sortMigrations(logger); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Only one instance may read and change the migration state at a time.
+	unlock, err := acquireLock(ctx, pool, logger, viper.GetDuration("Migrations.LockTimeout"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := ensureMigrationsTable(ctx, pool, logger); err != nil {
+		return err
+	}
+
+	if err := verifyChecksums(ctx, pool, logger, dryRun, allowDrift); err != nil {
+		return err
+	}
+
+	return rollback(ctx, pool, logger, dryRun, to)
+}
+
+func rollback(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger, dryRun bool, to int) error {
+	rows, err := pool.Query(ctx, "SELECT number FROM migrations WHERE number > $1 ORDER BY number DESC", max(to, 0))
+	if err != nil {
+		return fmt.Errorf("unable to list applied migrations: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[uint])
+	if err != nil {
+		return fmt.Errorf("unable to list applied migrations: %w", err)
+	}
+
+	if to == -1 && len(applied) > 1 {
+		applied = applied[:1]
+	}
+
+	if len(applied) == 0 {
+		logger.Info("no migrations to roll back")
+		return nil
+	}
+
+	// Check every migration can be reverted before reverting any of them.
+	byNumber := make(map[uint]*Migration, len(Migrations))
+	for _, migration := range Migrations {
+		byNumber[migration.Number] = migration
+	}
+	toRevert := make([]*Migration, 0, len(applied))
+	for _, number := range applied {
+		migration, ok := byNumber[number]
+		if !ok {
+			err := fmt.Errorf("applied migration %d is unknown to this build", number)
+			logger.Error("Unable to roll back migrations", "error", err)
+			return err
+		}
+		if !migration.reversible() {
+			err := fmt.Errorf("migration %d (%q) cannot be rolled back", number, migration.Name)
+			logger.Error("Unable to roll back migrations", "error", err)
+			return err
+		}
+		toRevert = append(toRevert, migration)
+	}
+
+	for _, migration := range toRevert {
+		migLogger := logger.With(
+			slog.Uint64("migration_number", uint64(migration.Number)),
+			slog.String("migration_name", migration.Name),
+		)
+		migLogger.Info("rolling back migration")
 
 		if dryRun {
 			continue
 		}
 
-		// Begin transaction
-		tx, err := pool.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("unable to begin transaction: %w", err)
+		if err := apply(ctx, pool, logger, migration, false); err != nil {
+			migLogger.Error("unable to roll back migration", "error", err)
+			return err
 		}
 
-		// Apply migration
-		if err := migration.Forwards(pool, logger); err != nil {
-			tx.Rollback(ctx)
-			migLogger.Errorf("unable to apply migration, rolling back. err: %+v", err)
+		migLogger.Info("migration rolled back successfully")
+	}
+
+	logger.Info("all migrations rolled back successfully")
+	return nil
+}
+
+// apply runs one migration forwards or backwards together with the change to
+// its migrations row.
+func apply(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger, migration *Migration, forwards bool) error {
+	record, args := "INSERT INTO migrations (number, name, checksum) VALUES ($1, $2, $3)", []interface{}{migration.Number, migration.Name, migration.Checksum()}
+	if !forwards {
+		record, args = "DELETE FROM migrations WHERE number = $1", []interface{}{migration.Number}
+	}
+
+	if migration.NoTransaction {
+		step := migration.ForwardsNoTx
+		if !forwards {
+			step = migration.BackwardsNoTx
+		}
+		if err := step(pool, logger); err != nil {
 			return err
 		}
+		if _, err := pool.Exec(ctx, record, args...); err != nil {
+			return fmt.Errorf("unable to record migration: %w", err)
+		}
+		return nil
+	}
 
-		// Record migration
-		_, err = tx.Exec(ctx, "INSERT INTO migrations (number, name) VALUES ($1, $2)", migration.Number, migration.Name)
-		if err != nil {
-			tx.Rollback(ctx)
+	step := migration.Forwards
+	if !forwards {
+		step = migration.Backwards
+	}
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if err := step(tx, logger); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, record, args...); err != nil {
 			return fmt.Errorf("unable to record migration: %w", err)
 		}
+		return nil
+	})
+}
 
-		// Commit transaction
-		if err := tx.Commit(ctx); err != nil {
-			migLogger.Errorf("unable to commit transaction... err: %+v", err)
+// sortMigrations checks migration numbers are unique and each migration has
+// the steps it needs, and sorts the migrations by number.
+func sortMigrations(logger *slog.Logger) error {
+	// Check for duplicate migration numbers
+	migrationIDs := make(map[uint]struct{})
+	for _, migration := range Migrations {
+		if _, ok := migrationIDs[migration.Number]; ok {
+			err := fmt.Errorf("duplicate migration number found: %d", migration.Number)
+			logger.Error("Unable to apply migrations", "error", err)
 			return err
 		}
+		migrationIDs[migration.Number] = struct{}{}
 
-		migLogger.Infof("migration %d applied successfully", migration.Number)
+		if err := migration.validate(); err != nil {
+			logger.Error("Unable to apply migrations", "error", err)
+			return err
+		}
 	}
 
-	logger.Infof("all migrations applied successfully")
+	// Sort migrations by number
+	sort.Slice(Migrations, func(i, j int) bool {
+		return Migrations[i].Number < Migrations[j].Number
+	})
 	return nil
 }
+
+func connect(ctx context.Context) (*pgxpool.Pool, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		viper.GetString("Database.Host"),
+		viper.GetInt("Database.Port"),
+		viper.GetString("Database.User"),
+		viper.GetString("Database.Password"),
+		viper.GetString("Database.Name"),
+	)
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+	return pool, nil
+}
+
+// ensureMigrationsTable creates the migrations table, or adds the columns
+// missing from one created by an earlier version.
+func ensureMigrationsTable(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger) error {
+	logger.Debug("ensuring migrations table is present")
+	createTableSQL := `
+		CREATE TABLE IF NOT EXISTS migrations (
+			number BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		ALTER TABLE migrations ADD COLUMN IF NOT EXISTS checksum CHAR(64);
+	`
+	if _, err := pool.Exec(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("unable to create migrations table: %w", err)
+	}
+	return nil
+}
+
+// latestMigration ensures the migrations table exists and returns the number
+// of the latest applied migration, or 0 if none has been applied.
+func latestMigration(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger) (uint, error) {
+	if err := ensureMigrationsTable(ctx, pool, logger); err != nil {
+		return 0, err
+	}
+
+	var latestNumber uint
+	err := pool.QueryRow(ctx, "SELECT COALESCE(MAX(number), 0) FROM migrations").Scan(&latestNumber)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find latest migration: %w", err)
+	}
+	return latestNumber, nil
+}
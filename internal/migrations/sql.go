@@ -0,0 +1,186 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql
+var sqlFiles embed.FS
+
+// noTransactionMarker on the first line of an up file runs the migration
+// outside a transaction.
+const noTransactionMarker = "-- migrate:no-transaction"
+
+var sqlFileName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// loadSQLMigrations builds migrations from the NNNN_name.up.sql and
+// NNNN_name.down.sql files in the root of fsys.
+func loadSQLMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[uint]*sqlMigration)
+	var numbers []uint
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		match := sqlFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		number, _ := strconv.ParseUint(match[1], 10, 64)
+
+		m, ok := byNumber[uint(number)]
+		if !ok {
+			m = &sqlMigration{number: uint(number), name: match[2]}
+			byNumber[uint(number)] = m
+			numbers = append(numbers, uint(number))
+		}
+		if m.name != match[2] {
+			return nil, fmt.Errorf("migration files %s_%s and %s_%s share a number", match[1], m.name, match[1], match[2])
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(numbers))
+	for _, number := range numbers {
+		m := byNumber[number]
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.number, m.name)
+		}
+		migrations = append(migrations, m.migration())
+	}
+	return migrations, nil
+}
+
+type sqlMigration struct {
+	number uint
+	name   string
+	up     string
+	down   string
+}
+
+func (m *sqlMigration) migration() *Migration {
+	migration := &Migration{
+		Number:        m.number,
+		Name:          displayName(m.name),
+		NoTransaction: strings.HasPrefix(m.up, noTransactionMarker),
+		checksum:      checksum([]byte(m.up)),
+	}
+
+	if migration.NoTransaction {
+		migration.ForwardsNoTx = m.runOnPool(m.up, "up")
+		if m.down != "" {
+			migration.BackwardsNoTx = m.runOnPool(m.down, "down")
+		}
+		return migration
+	}
+
+	migration.Forwards = m.runInTx(m.up, "up")
+	if m.down != "" {
+		migration.Backwards = m.runInTx(m.down, "down")
+	}
+	return migration
+}
+
+func (m *sqlMigration) runInTx(sql string, direction string) func(tx pgx.Tx, logger *slog.Logger) error {
+	return func(tx pgx.Tx, logger *slog.Logger) error {
+		if _, err := tx.Exec(context.Background(), sql); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("%04d_%s.%s.sql executed successfully", m.number, m.name, direction))
+		return nil
+	}
+}
+
+func (m *sqlMigration) runOnPool(sql string, direction string) func(db *pgxpool.Pool, logger *slog.Logger) error {
+	return func(db *pgxpool.Pool, logger *slog.Logger) error {
+		if _, err := db.Exec(context.Background(), sql); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("%04d_%s.%s.sql executed successfully", m.number, m.name, direction))
+		return nil
+	}
+}
+
+// displayName turns a file name such as add_visit_notes into "Add visit notes".
+func displayName(name string) string {
+	name = strings.ReplaceAll(name, "_", " ")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// Create scaffolds the up and down files of a new SQL migration in dir,
+// numbered after the latest Go or SQL migration.
+func Create(logger *slog.Logger, dir string, name string) error {
+	slug := strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return fmt.Errorf("invalid migration name %q", name)
+	}
+
+	var latest uint
+	for _, migration := range Migrations {
+		latest = max(latest, migration.Number)
+	}
+	// Files created since this binary was built are not embedded yet.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read migrations directory: %w", err)
+	}
+	for _, entry := range entries {
+		if match := sqlFileName.FindStringSubmatch(entry.Name()); match != nil {
+			number, _ := strconv.ParseUint(match[1], 10, 64)
+			latest = max(latest, uint(number))
+		}
+	}
+
+	base := fmt.Sprintf("%04d_%s", latest+1, slug)
+	files := []struct{ name, contents string }{
+		{base + ".up.sql", fmt.Sprintf("-- %s\n\n", displayName(slug))},
+		{base + ".down.sql", fmt.Sprintf("-- Reverts %s.up.sql. Delete this file if the migration cannot be rolled back.\n\n", base)},
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, []byte(file.contents), 0o644); err != nil {
+			return fmt.Errorf("unable to create migration file: %w", err)
+		}
+		logger.Info("created migration file", "path", path)
+	}
+	return nil
+}
+
+func init() {
+	root, err := fs.Sub(sqlFiles, "sql")
+	if err != nil {
+		panic(err)
+	}
+	sqlMigrations, err := loadSQLMigrations(root)
+	if err != nil {
+		panic(err)
+	}
+	Migrations = append(Migrations, sqlMigrations...)
+}
@@ -0,0 +1,2 @@
+-- Reverts 0011_deactivate_legacy_seed_accounts.up.sql. The accounts stay
+-- deactivated: they have a well-known password and must not come back.
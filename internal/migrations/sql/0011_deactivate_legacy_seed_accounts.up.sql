@@ -0,0 +1,16 @@
+-- Migration 0002 used to create the accounts admin (hn-001) and staff_b
+-- (hn-002), with the password "password", in every database. Databases
+-- migrated back then still have them, so they are deactivated here and their
+-- sessions revoked. Only accounts created before migration 0002 was recorded
+-- that still have the default password match; accounts of these names loaded
+-- later by the seed command are left alone.
+WITH deactivated AS (
+	UPDATE staff SET is_active = FALSE, deactivated_at = NOW()
+	WHERE username IN ('admin', 'staff_b')
+	  AND password_hash = '$2a$12$VsfCQivbKsbMdc8i9jMTTO2ekdf7FBjIH9r8X1SH4UG6GFZVNsnsK'
+	  AND is_active
+	  AND created_at <= (SELECT applied_at FROM migrations WHERE number = 2)
+	RETURNING id
+)
+UPDATE refresh_tokens SET revoked_at = NOW()
+WHERE staff_id IN (SELECT id FROM deactivated) AND revoked_at IS NULL;
@@ -0,0 +1,21 @@
+-- Each person gets the contact details of their most recently changed live
+-- registration. Emails are unique among persons again, so this fails if two
+-- persons registered the same email at different hospitals.
+ALTER TABLE persons
+	ADD COLUMN phone_number VARCHAR(20),
+	ADD COLUMN email VARCHAR(255);
+
+UPDATE persons p SET phone_number = r.phone_number, email = r.email
+FROM (
+	SELECT DISTINCT ON (person_id) person_id, phone_number, email
+	FROM patients
+	ORDER BY person_id, deleted_at IS NOT NULL, COALESCE(updated_at, created_at) DESC, id
+) r
+WHERE r.person_id = p.id;
+
+CREATE UNIQUE INDEX uq_persons_email ON persons(email);
+
+DROP INDEX uq_patients_hospital_email;
+ALTER TABLE patients
+	DROP COLUMN phone_number,
+	DROP COLUMN email;
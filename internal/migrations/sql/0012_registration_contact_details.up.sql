@@ -0,0 +1,17 @@
+-- Phone numbers and emails belong to a person's registration at a hospital
+-- rather than to the person, so that a hospital changing them does not change
+-- what the other hospitals the person is registered at see. Existing
+-- registrations start with the details of their person.
+ALTER TABLE patients
+	ADD COLUMN phone_number VARCHAR(20),
+	ADD COLUMN email VARCHAR(255);
+
+UPDATE patients r SET phone_number = p.phone_number, email = p.email
+FROM persons p
+WHERE p.id = r.person_id;
+
+CREATE UNIQUE INDEX uq_patients_hospital_email ON patients(hospital_id, email) WHERE deleted_at IS NULL;
+
+ALTER TABLE persons
+	DROP COLUMN phone_number,
+	DROP COLUMN email;
@@ -0,0 +1,3 @@
+-- Expired refresh tokens are deleted whenever a new one is stored, as expired
+-- revoked access tokens are, and this index finds them.
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSQLMigrations(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		migrations, err := loadSQLMigrations(fstest.MapFS{
+			"0011_add_visit_notes.up.sql":      {Data: []byte("CREATE TABLE visit_notes (id UUID);")},
+			"0011_add_visit_notes.down.sql":    {Data: []byte("DROP TABLE visit_notes;")},
+			"0012_index_visit_notes.up.sql":    {Data: []byte(noTransactionMarker + "\nCREATE INDEX CONCURRENTLY idx ON visit_notes(id);")},
+			"0013_backfill_visit_notes.up.sql": {Data: []byte("UPDATE visit_notes SET id = id;")},
+			"README.md":                        {Data: []byte("# SQL migrations")},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, migrations, 3)
+
+		assert.Equal(t, uint(11), migrations[0].Number)
+		assert.Equal(t, "Add visit notes", migrations[0].Name)
+		assert.NotNil(t, migrations[0].Forwards)
+		assert.True(t, migrations[0].reversible())
+		assert.NoError(t, migrations[0].validate())
+
+		assert.True(t, migrations[1].NoTransaction)
+		assert.NotNil(t, migrations[1].ForwardsNoTx)
+		assert.False(t, migrations[1].reversible())
+		assert.NoError(t, migrations[1].validate())
+
+		assert.False(t, migrations[2].reversible())
+	})
+
+	t.Run("Invalid File Name", func(t *testing.T) {
+		_, err := loadSQLMigrations(fstest.MapFS{
+			"11_add_visit_notes.sql": {Data: []byte("SELECT 1;")},
+		})
+		assert.ErrorContains(t, err, "invalid migration file name")
+	})
+
+	t.Run("Missing Up File", func(t *testing.T) {
+		_, err := loadSQLMigrations(fstest.MapFS{
+			"0011_add_visit_notes.down.sql": {Data: []byte("DROP TABLE visit_notes;")},
+		})
+		assert.ErrorContains(t, err, "has no up file")
+	})
+
+	t.Run("Conflicting Names", func(t *testing.T) {
+		_, err := loadSQLMigrations(fstest.MapFS{
+			"0011_add_visit_notes.up.sql": {Data: []byte("SELECT 1;")},
+			"0011_add_visit_dates.up.sql": {Data: []byte("SELECT 1;")},
+		})
+		assert.ErrorContains(t, err, "share a number")
+	})
+}
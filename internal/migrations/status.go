@@ -0,0 +1,131 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// States reported by Status.
+const (
+	StateApplied = "applied"
+	StatePending = "pending"
+	// StateChanged is an applied migration whose forwards step has changed
+	// since it was applied.
+	StateChanged = "changed"
+	// StateUnknown is an applied migration missing from this build.
+	StateUnknown = "unknown"
+)
+
+type MigrationStatus struct {
+	Number    uint       `json:"number"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type appliedMigration struct {
+	number    uint
+	name      string
+	appliedAt *time.Time
+	checksum  *string
+}
+
+// appliedMigrations lists the migrations recorded in the migrations table,
+// reading it as it is: none if it does not exist yet, and no checksums if it
+// was created by a version that did not record them.
+func appliedMigrations(ctx context.Context, pool *pgxpool.Pool) ([]appliedMigration, error) {
+	var exists, hasChecksum bool
+	err := pool.QueryRow(ctx, `
+		SELECT to_regclass('migrations') IS NOT NULL, EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'migrations' AND column_name = 'checksum'
+		)
+	`).Scan(&exists, &hasChecksum)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find migrations table: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	checksumColumn := "checksum"
+	if !hasChecksum {
+		checksumColumn = "NULL"
+	}
+	rows, err := pool.Query(ctx, "SELECT number, name, applied_at, "+checksumColumn+" FROM migrations ORDER BY number")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list applied migrations: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (appliedMigration, error) {
+		var m appliedMigration
+		err := row.Scan(&m.number, &m.name, &m.appliedAt, &m.checksum)
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// Status lists every known or applied migration by number with its state.
+// Before the first migration run every migration is pending.
+func Status(logger *slog.Logger) ([]MigrationStatus, error) {
+	if err := sortMigrations(logger); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Close()
+
+	// Status only reads; creating or upgrading the migrations table is left
+	// to Migrate, which holds the migration lock while it does.
+	applied, err := appliedMigrations(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[uint]appliedMigration, len(applied))
+	for _, record := range applied {
+		byNumber[record.number] = record
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range Migrations {
+		status := MigrationStatus{Number: migration.Number, Name: migration.Name, State: StatePending}
+		if record, ok := byNumber[migration.Number]; ok {
+			status.State = StateApplied
+			status.AppliedAt = record.appliedAt
+
+			if record.checksum != nil && *record.checksum != migration.Checksum() {
+				status.State = StateChanged
+			}
+			delete(byNumber, migration.Number)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range applied {
+		if _, ok := byNumber[record.number]; ok {
+			statuses = append(statuses, MigrationStatus{
+				Number:    record.number,
+				Name:      record.name,
+				State:     StateUnknown,
+				AppliedAt: record.appliedAt,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Number < statuses[j].Number
+	})
+	return statuses, nil
+}
@@ -0,0 +1,160 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPatientRepository is a mock implementation of repository.PatientRepository
+type MockPatientRepository struct {
+	mock.Mock
+}
+
+func (m *MockPatientRepository) Search(ctx context.Context, search repository.PatientSearch) (*repository.PatientPage, error) {
+	ret := m.Called(ctx, search)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(*repository.PatientPage), ret.Error(1)
+}
+
+func (m *MockPatientRepository) List(ctx context.Context, filter repository.PatientFilter, offset int, limit int) ([]*models.Patient, error) {
+	ret := m.Called(ctx, filter, offset, limit)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).([]*models.Patient), ret.Error(1)
+}
+
+func (m *MockPatientRepository) Count(ctx context.Context, filter repository.PatientFilter) (int64, error) {
+	ret := m.Called(ctx, filter)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *MockPatientRepository) GetByID(ctx context.Context, hospitalID string, id uuid.UUID) (*models.Patient, error) {
+	return m.patient(m.Called(ctx, hospitalID, id))
+}
+
+func (m *MockPatientRepository) GetByNationalID(ctx context.Context, hospitalID string, nationalID string) (*models.Patient, error) {
+	return m.patient(m.Called(ctx, hospitalID, nationalID))
+}
+
+func (m *MockPatientRepository) GetByPassportID(ctx context.Context, hospitalID string, passportID string) (*models.Patient, error) {
+	return m.patient(m.Called(ctx, hospitalID, passportID))
+}
+
+func (m *MockPatientRepository) Create(ctx context.Context, hospitalID string, input *models.CreatePatientRequest) (*models.Patient, error) {
+	return m.patient(m.Called(ctx, hospitalID, input))
+}
+
+func (m *MockPatientRepository) Update(ctx context.Context, hospitalID string, id uuid.UUID, input *models.UpdatePatientRequest) (*models.Patient, error) {
+	return m.patient(m.Called(ctx, hospitalID, id, input))
+}
+
+func (m *MockPatientRepository) Delete(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	ret := m.Called(ctx, hospitalID, id)
+	return ret.Error(0)
+}
+
+func (m *MockPatientRepository) patient(ret mock.Arguments) (*models.Patient, error) {
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(*models.Patient), ret.Error(1)
+}
+
+// MockStaffRepository is a mock implementation of repository.StaffRepository
+type MockStaffRepository struct {
+	mock.Mock
+}
+
+func (m *MockStaffRepository) GetActive(ctx context.Context, username string, hospitalCode string) (*models.Staff, error) {
+	ret := m.Called(ctx, username, hospitalCode)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(*models.Staff), ret.Error(1)
+}
+
+func (m *MockStaffRepository) Create(ctx context.Context, hospitalID string, username string, passwordHash string, roles []string) (uuid.UUID, error) {
+	ret := m.Called(ctx, hospitalID, username, passwordHash, roles)
+	return ret.Get(0).(uuid.UUID), ret.Error(1)
+}
+
+func (m *MockStaffRepository) Deactivate(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	ret := m.Called(ctx, hospitalID, id)
+	return ret.Error(0)
+}
+
+func (m *MockStaffRepository) Access(ctx context.Context, staffID uuid.UUID) ([]string, []string, error) {
+	ret := m.Called(ctx, staffID)
+	if ret.Get(0) == nil {
+		return nil, nil, ret.Error(2)
+	}
+	return ret.Get(0).([]string), ret.Get(1).([]string), ret.Error(2)
+}
+
+func (m *MockStaffRepository) StoreRefreshToken(ctx context.Context, staffID uuid.UUID, familyID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	ret := m.Called(ctx, staffID, familyID, tokenHash, expiresAt)
+	return ret.Error(0)
+}
+
+func (m *MockStaffRepository) RotateRefreshToken(ctx context.Context, tokenHash string) (*repository.RefreshSession, error) {
+	ret := m.Called(ctx, tokenHash)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(*repository.RefreshSession), ret.Error(1)
+}
+
+func (m *MockStaffRepository) RevokeReusedRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	ret := m.Called(ctx, tokenHash)
+	return ret.Get(0).(int64), ret.Error(1)
+}
+
+func (m *MockStaffRepository) RevokeSession(ctx context.Context, staffID string, tokenHash string) error {
+	ret := m.Called(ctx, staffID, tokenHash)
+	return ret.Error(0)
+}
+
+func (m *MockStaffRepository) RevokeAccessToken(ctx context.Context, jti string, staffID string, expiresAt time.Time) error {
+	ret := m.Called(ctx, jti, staffID, expiresAt)
+	return ret.Error(0)
+}
+
+func (m *MockStaffRepository) IsAccessRevoked(ctx context.Context, jti string, staffID string) (bool, error) {
+	ret := m.Called(ctx, jti, staffID)
+	return ret.Bool(0), ret.Error(1)
+}
+
+// MockAuditRepository is a mock implementation of repository.AuditRepository
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Record(ctx context.Context, record repository.AuditRecord) error {
+	ret := m.Called(ctx, record)
+	return ret.Error(0)
+}
+
+func (m *MockAuditRepository) List(ctx context.Context, filter repository.AuditFilter, limit int) ([]*models.AuditEvent, bool, error) {
+	ret := m.Called(ctx, filter, limit)
+	if ret.Get(0) == nil {
+		return nil, false, ret.Error(2)
+	}
+	return ret.Get(0).([]*models.AuditEvent), ret.Bool(1), ret.Error(2)
+}
+
+func (m *MockAuditRepository) Verify(ctx context.Context, hospitalID string) (*models.AuditVerifyResponse, error) {
+	ret := m.Called(ctx, hospitalID)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(*models.AuditVerifyResponse), ret.Error(1)
+}
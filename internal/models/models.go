@@ -1,16 +1,26 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Hospital struct {
+	ID   uuid.UUID `json:"id"`
+	Code string    `json:"code"`
+	Name string    `json:"name"`
+}
+
 type Staff struct {
 	ID           uuid.UUID `json:"id"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
-	Hospital     string    `json:"hospital"`
+	HospitalID   uuid.UUID `json:"hospital_id"`
+	Hospital     string    `json:"hospital"` // Hospital code
+	IsActive     bool      `json:"is_active"`
+	Roles        []string  `json:"roles"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -37,22 +47,44 @@ func (d *Date) Scan(value interface{}) error {
 	return nil
 }
 
+// NullString is a string column that may be NULL. NULL scans as the empty
+// string, so optional patient details read like any other string.
+type NullString string
+
+func (s *NullString) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+	case string:
+		*s = NullString(v)
+	case []byte:
+		*s = NullString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into NullString", value)
+	}
+	return nil
+}
+
+// Patient is a person's registration at a hospital. The db tags name the
+// columns patient queries select.
 type Patient struct {
-	ID           uuid.UUID  `json:"id"`
-	PatientHN    string     `json:"patient_hn"` // Hospital Number
-	FirstNameTH  string     `json:"first_name_th"`
-	MiddleNameTH string     `json:"middle_name_th"`
-	LastNameTH   string     `json:"last_name_th"`
-	FirstNameEN  string     `json:"first_name_en"`
-	MiddleNameEN string     `json:"middle_name_en"`
-	LastNameEN   string     `json:"last_name_en"`
-	DateOfBirth  *Date      `json:"date_of_birth"`
-	Gender       string     `json:"gender"`
-	NationalID   string     `json:"national_id"`
-	PassportID   string     `json:"passport_id"`
-	PhoneNumber  string     `json:"phone_number"`
-	Email        string     `json:"email"`
-	CreatedAt    *time.Time `json:"-"`
+	ID           uuid.UUID  `json:"id" db:"id"`
+	HospitalID   uuid.UUID  `json:"hospital_id" db:"hospital_id"`
+	PatientHN    string     `json:"patient_hn" db:"patient_hn"` // Hospital Number, unique within the hospital
+	FirstNameTH  NullString `json:"first_name_th" db:"first_name_th"`
+	MiddleNameTH NullString `json:"middle_name_th" db:"middle_name_th"`
+	LastNameTH   NullString `json:"last_name_th" db:"last_name_th"`
+	FirstNameEN  NullString `json:"first_name_en" db:"first_name_en"`
+	MiddleNameEN NullString `json:"middle_name_en" db:"middle_name_en"`
+	LastNameEN   NullString `json:"last_name_en" db:"last_name_en"`
+	DateOfBirth  *Date      `json:"date_of_birth" db:"date_of_birth"`
+	Gender       NullString `json:"gender" db:"gender"`
+	NationalID   NullString `json:"national_id" db:"national_id"`
+	PassportID   NullString `json:"passport_id" db:"passport_id"`
+	PhoneNumber  NullString `json:"phone_number" db:"phone_number"`
+	Email        NullString `json:"email" db:"email"`
+	CreatedAt    *time.Time `json:"-" db:"-"`
+	Score        *float64   `json:"score,omitempty" db:"-"` // Name similarity, only set by fuzzy search
 }
 
 type LoginRequest struct {
@@ -62,11 +94,100 @@ type LoginRequest struct {
 }
 
 type CreateStaffRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	Hospital string `json:"hospital" binding:"required"`
+	Username string   `json:"username" binding:"required"`
+	Password string   `json:"password" binding:"required"`
+	Hospital string   `json:"hospital" binding:"required"`
+	Roles    []string `json:"roles" binding:"omitempty,dive,oneof=hospital_admin clerk doctor auditor"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+type CreatePatientRequest struct {
+	FirstNameTH  string `json:"first_name_th" binding:"required_without=FirstNameEN,max=255"`
+	MiddleNameTH string `json:"middle_name_th" binding:"max=255"`
+	LastNameTH   string `json:"last_name_th" binding:"required_without=LastNameEN,max=255"`
+	FirstNameEN  string `json:"first_name_en" binding:"required_without=FirstNameTH,max=255"`
+	MiddleNameEN string `json:"middle_name_en" binding:"max=255"`
+	LastNameEN   string `json:"last_name_en" binding:"required_without=LastNameTH,max=255"`
+	DateOfBirth  string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	Gender       string `json:"gender" binding:"omitempty,oneof=M F"`
+	NationalID   string `json:"national_id" binding:"required_without=PassportID,max=13"`
+	PassportID   string `json:"passport_id" binding:"required_without=NationalID,max=20"`
+	PhoneNumber  string `json:"phone_number" binding:"max=20"`
+	Email        string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+// UpdatePatientRequest is a partial update: nil fields are left unchanged and
+// an empty name, phone or identifier clears the column.
+type UpdatePatientRequest struct {
+	FirstNameTH  *string `json:"first_name_th" binding:"omitempty,max=255"`
+	MiddleNameTH *string `json:"middle_name_th" binding:"omitempty,max=255"`
+	LastNameTH   *string `json:"last_name_th" binding:"omitempty,max=255"`
+	FirstNameEN  *string `json:"first_name_en" binding:"omitempty,max=255"`
+	MiddleNameEN *string `json:"middle_name_en" binding:"omitempty,max=255"`
+	LastNameEN   *string `json:"last_name_en" binding:"omitempty,max=255"`
+	DateOfBirth  *string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	Gender       *string `json:"gender" binding:"omitempty,oneof=M F"`
+	NationalID   *string `json:"national_id" binding:"omitempty,max=13"`
+	PassportID   *string `json:"passport_id" binding:"omitempty,max=20"`
+	PhoneNumber  *string `json:"phone_number" binding:"omitempty,max=20"`
+	Email        *string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+// IsEmpty reports whether the request changes nothing.
+func (r *UpdatePatientRequest) IsEmpty() bool {
+	for _, field := range []*string{
+		r.FirstNameTH, r.MiddleNameTH, r.LastNameTH, r.FirstNameEN, r.MiddleNameEN, r.LastNameEN,
+		r.DateOfBirth, r.Gender, r.NationalID, r.PassportID, r.PhoneNumber, r.Email,
+	} {
+		if field != nil {
+			return false
+		}
+	}
+	return true
 }
 
 type SearchPatientResponse struct {
-	Patient []*Patient `json:"patients"`
+	Patient    []*Patient `json:"patients"`
+	NextCursor string     `json:"next_cursor,omitempty"` // Pass as cursor to fetch the next page
+	Total      *int64     `json:"total,omitempty"`       // Only set when include_total=true
+}
+
+// AuditEvent is one entry of the hash-chained audit trail.
+type AuditEvent struct {
+	Seq           int64             `json:"seq"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	StaffID       *uuid.UUID        `json:"staff_id"`
+	HospitalID    *uuid.UUID        `json:"hospital_id"`
+	Action        string            `json:"action"`
+	PatientIDs    []uuid.UUID       `json:"patient_ids"`
+	TargetStaffID *uuid.UUID        `json:"target_staff_id,omitempty"`
+	Filters       map[string]string `json:"filters"`
+	RequestID     string            `json:"request_id"`
+	IPAddress     string            `json:"ip_address"`
+	PrevHash      string            `json:"prev_hash"`
+	Hash          string            `json:"hash"`
+}
+
+type AuditEventsResponse struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Pass as cursor to fetch older events
+}
+
+type AuditVerifyResponse struct {
+	Valid           bool   `json:"valid"`
+	Events          int64  `json:"events"`
+	FirstInvalidSeq *int64 `json:"first_invalid_seq,omitempty"`
 }
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"agnos_demo/internal/database"
+	"agnos_demo/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresAuditRepository stores the audit trail in PostgreSQL, where
+// triggers chain each event to the previous one by hash.
+type PostgresAuditRepository struct {
+	db database.DB
+}
+
+func NewPostgresAuditRepository(db database.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db}
+}
+
+func (r *PostgresAuditRepository) Record(ctx context.Context, record AuditRecord) error {
+	query := `
+		INSERT INTO audit_events (staff_id, hospital_id, action, patient_ids, target_staff_id, filters, request_id, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::inet)
+	`
+
+	_, err := r.db.Exec(ctx, query,
+		nullIfEmpty(record.StaffID), nullIfEmpty(record.HospitalID), record.Action,
+		record.PatientIDs, record.TargetStaffID, record.Filters,
+		nullIfEmpty(record.RequestID), nullIfEmpty(record.IPAddress),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to record audit event: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresAuditRepository) List(ctx context.Context, filter AuditFilter, limit int) ([]*models.AuditEvent, bool, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	conditions = append(conditions, fmt.Sprintf("hospital_id = $%d", argIndex))
+	args = append(args, filter.HospitalID)
+	argIndex++
+
+	if filter.StaffID != nil {
+		conditions = append(conditions, fmt.Sprintf("staff_id = $%d", argIndex))
+		args = append(args, *filter.StaffID)
+		argIndex++
+	}
+	if filter.PatientID != nil {
+		conditions = append(conditions, fmt.Sprintf("patient_ids @> ARRAY[$%d::uuid]", argIndex))
+		args = append(args, *filter.PatientID)
+		argIndex++
+	}
+	if filter.From != nil {
+		conditions = append(conditions, fmt.Sprintf("occurred_at >= $%d", argIndex))
+		args = append(args, *filter.From)
+		argIndex++
+	}
+	if filter.To != nil {
+		conditions = append(conditions, fmt.Sprintf("occurred_at < $%d", argIndex))
+		args = append(args, *filter.To)
+		argIndex++
+	}
+	if filter.BeforeSeq > 0 {
+		conditions = append(conditions, fmt.Sprintf("seq < $%d", argIndex))
+		args = append(args, filter.BeforeSeq)
+		argIndex++
+	}
+
+	// One extra row tells whether there are older events.
+	query := fmt.Sprintf(`
+		SELECT seq, occurred_at, staff_id, hospital_id, action, patient_ids, target_staff_id, filters,
+			COALESCE(request_id, ''), COALESCE(host(ip_address), ''), prev_hash, hash
+		FROM audit_events
+		WHERE %s
+		ORDER BY seq DESC
+		LIMIT $%d`,
+		strings.Join(conditions, " AND "), argIndex,
+	)
+	args = append(args, limit+1)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to query audit trail: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.AuditEvent, error) {
+		var e models.AuditEvent
+		err := row.Scan(
+			&e.Seq, &e.OccurredAt, &e.StaffID, &e.HospitalID, &e.Action, &e.PatientIDs,
+			&e.TargetStaffID, &e.Filters, &e.RequestID, &e.IPAddress, &e.PrevHash, &e.Hash,
+		)
+		return &e, err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read audit events: %w", err)
+	}
+
+	if len(events) > limit {
+		return events[:limit], true, nil
+	}
+	return events, false, nil
+}
+
+func (r *PostgresAuditRepository) Verify(ctx context.Context, hospitalID string) (*models.AuditVerifyResponse, error) {
+	// The chain links the events of all hospitals, so all of them are
+	// checked, but only those of the hospital are counted and reported.
+	query := `
+		WITH checked AS (
+			SELECT seq, hospital_id,
+				hash = audit_event_hash(e)
+				AND prev_hash = COALESCE(lag(hash) OVER (ORDER BY seq), repeat('0', 64))
+				AND seq = COALESCE(lag(seq) OVER (ORDER BY seq), 0) + 1 AS valid
+			FROM audit_events e
+		)
+		SELECT COUNT(*), MIN(seq) FILTER (WHERE NOT valid)
+		FROM checked
+		WHERE hospital_id = $1
+	`
+
+	var result models.AuditVerifyResponse
+	if err := r.db.QueryRow(ctx, query, hospitalID).Scan(&result.Events, &result.FirstInvalidSeq); err != nil {
+		return nil, fmt.Errorf("unable to verify audit trail: %w", err)
+	}
+	result.Valid = result.FirstInvalidSeq == nil
+	return &result, nil
+}
@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"agnos_demo/internal/mocks"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuditList(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+	mockRows := new(mocks.MockRows)
+
+	// limit=1 fetches 2 rows; the second only signals that more exist
+	mockRows.On("Next").Return(true).Times(2)
+	mockRows.On("Next").Return(false).Once()
+
+	seq := int64(42)
+	mockRows.On("Scan",
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+	).Run(func(args mock.Arguments) {
+		*args.Get(0).(*int64) = seq
+		seq--
+	}).Return(nil)
+	mockRows.On("Err").Return(nil)
+	mockRows.On("Close").Return()
+
+	patientID := uuid.New()
+	listQuery := mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "patient_ids @> ARRAY[$2::uuid]") && strings.Contains(sql, "seq < $3")
+	})
+	mockDB.On("Query", mock.Anything, listQuery, []interface{}{testHospitalID, patientID, int64(50), 2}).Return(mockRows, nil)
+
+	repo := repository.NewPostgresAuditRepository(mockDB)
+	events, more, err := repo.List(context.Background(), repository.AuditFilter{
+		HospitalID: testHospitalID,
+		PatientID:  &patientID,
+		BeforeSeq:  50,
+	}, 1)
+
+	assert.NoError(t, err)
+	assert.True(t, more)
+	assert.Len(t, events, 1)
+	assert.Equal(t, int64(42), events[0].Seq)
+	mockDB.AssertExpectations(t)
+}
+
+func TestAuditVerify(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		mockRow := new(mocks.MockRow)
+		mockRow.On("Scan", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*int64) = 10
+		}).Return(nil)
+		mockDB.On("QueryRow", mock.Anything, mock.Anything, []interface{}{testHospitalID}).Return(mockRow)
+
+		result, err := repository.NewPostgresAuditRepository(mockDB).Verify(context.Background(), testHospitalID)
+
+		assert.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Equal(t, int64(10), result.Events)
+	})
+
+	t.Run("Broken Chain", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		mockRow := new(mocks.MockRow)
+		mockRow.On("Scan", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*int64) = 10
+			invalid := int64(7)
+			*args.Get(1).(**int64) = &invalid
+		}).Return(nil)
+		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+
+		result, err := repository.NewPostgresAuditRepository(mockDB).Verify(context.Background(), testHospitalID)
+
+		assert.NoError(t, err)
+		assert.False(t, result.Valid)
+		assert.Equal(t, int64(7), *result.FirstInvalidSeq)
+	})
+}
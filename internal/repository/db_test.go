@@ -0,0 +1,45 @@
+package repository_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"agnos_demo/internal/migrations"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// testPool migrates the Postgres database named by TEST_DATABASE_URL from an
+// empty schema and connects to it, and skips the test if it is not set. The
+// schema is dropped first, so it must not hold data worth keeping.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	require.NoError(t, err)
+	t.Cleanup(viper.Reset)
+	viper.Set("App.Environment", "test")
+	viper.Set("Database.Host", config.Host)
+	viper.Set("Database.Port", int(config.Port))
+	viper.Set("Database.User", config.User)
+	viper.Set("Database.Password", config.Password)
+	viper.Set("Database.Name", config.Database)
+	viper.Set("Migrations.BackupDir", t.TempDir())
+	viper.Set("Migrations.LockTimeout", time.Minute)
+	require.NoError(t, migrations.Migrate(slog.New(slog.DiscardHandler), false, -1, true, "", false))
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
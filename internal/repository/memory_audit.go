@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryAuditRepository keeps a hash-chained audit trail in memory, for tests
+// that need the behavior of PostgresAuditRepository without a database.
+type MemoryAuditRepository struct {
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Record(ctx context.Context, record AuditRecord) error {
+	staffID, err := parseOptionalUUID(record.StaffID)
+	if err != nil {
+		return fmt.Errorf("unable to record audit event: %w", err)
+	}
+	hospitalID, err := parseOptionalUUID(record.HospitalID)
+	if err != nil {
+		return fmt.Errorf("unable to record audit event: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := &models.AuditEvent{
+		Seq:           int64(len(r.events)) + 1,
+		OccurredAt:    time.Now().UTC().Truncate(time.Microsecond),
+		StaffID:       staffID,
+		HospitalID:    hospitalID,
+		Action:        record.Action,
+		PatientIDs:    append([]uuid.UUID{}, record.PatientIDs...),
+		TargetStaffID: record.TargetStaffID,
+		Filters:       map[string]string{},
+		RequestID:     record.RequestID,
+		IPAddress:     record.IPAddress,
+		PrevHash:      strings.Repeat("0", 64),
+	}
+	for key, value := range record.Filters {
+		e.Filters[key] = value
+	}
+	if len(r.events) > 0 {
+		e.PrevHash = r.events[len(r.events)-1].Hash
+	}
+	e.Hash = memoryAuditHash(e)
+
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *MemoryAuditRepository) List(ctx context.Context, filter AuditFilter, limit int) ([]*models.AuditEvent, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*models.AuditEvent{}
+	for i := len(r.events) - 1; i >= 0; i-- {
+		e := r.events[i]
+		switch {
+		case e.HospitalID == nil || e.HospitalID.String() != filter.HospitalID:
+		case filter.StaffID != nil && (e.StaffID == nil || *e.StaffID != *filter.StaffID):
+		case filter.PatientID != nil && !slices.Contains(e.PatientIDs, *filter.PatientID):
+		case filter.From != nil && e.OccurredAt.Before(*filter.From):
+		case filter.To != nil && !e.OccurredAt.Before(*filter.To):
+		case filter.BeforeSeq > 0 && e.Seq >= filter.BeforeSeq:
+		default:
+			if len(events) == limit {
+				return events, true, nil
+			}
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	return events, false, nil
+}
+
+func (r *MemoryAuditRepository) Verify(ctx context.Context, hospitalID string) (*models.AuditVerifyResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &models.AuditVerifyResponse{}
+	prevHash := strings.Repeat("0", 64)
+	for i, e := range r.events {
+		valid := e.Hash == memoryAuditHash(e) && e.PrevHash == prevHash && e.Seq == int64(i)+1
+		prevHash = e.Hash
+		if e.HospitalID == nil || e.HospitalID.String() != hospitalID {
+			continue
+		}
+
+		result.Events++
+		if !valid && result.FirstInvalidSeq == nil {
+			seq := e.Seq
+			result.FirstInvalidSeq = &seq
+		}
+	}
+	result.Valid = result.FirstInvalidSeq == nil
+	return result, nil
+}
+
+// Tamper lets tests change a recorded event, which the database forbids, to
+// check that Verify notices.
+func (r *MemoryAuditRepository) Tamper(seq int64, change func(e *models.AuditEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.events {
+		if e.Seq == seq {
+			change(e)
+		}
+	}
+}
+
+// memoryAuditHash hashes an event the way audit_event_hash does, except that
+// the filters are encoded by encoding/json rather than as jsonb text.
+func memoryAuditHash(e *models.AuditEvent) string {
+	patientIDs := make([]string, len(e.PatientIDs))
+	for i, id := range e.PatientIDs {
+		patientIDs[i] = id.String()
+	}
+	filters, _ := json.Marshal(e.Filters)
+
+	fields := []string{
+		strconv.FormatInt(e.Seq, 10),
+		e.PrevHash,
+		e.OccurredAt.UTC().Format(memorySortTime),
+		uuidText(e.StaffID),
+		uuidText(e.HospitalID),
+		e.Action,
+		strings.Join(patientIDs, ","),
+		uuidText(e.TargetStaffID),
+		string(filters),
+		e.RequestID,
+		e.IPAddress,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseOptionalUUID parses a UUID column value where the empty string stands
+// for NULL.
+func parseOptionalUUID(s string) (*uuid.UUID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func uuidText(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,542 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memorySortTime formats timestamps so that they sort as text, at the
+// microsecond precision of a timestamptz.
+const memorySortTime = "2006-01-02T15:04:05.000000Z"
+
+// MemoryPatientRepository keeps patients in memory for tests that need the
+// behavior of PostgresPatientRepository without a database. Like the schema,
+// it shares a person's details but not their contact details between their
+// registrations, scopes registrations to a hospital, soft-deletes them, and
+// enforces the unique indexes and identifier check. Names are matched by
+// simple case folding and sorted by code point rather than by the database
+// collation.
+type MemoryPatientRepository struct {
+	mu            sync.Mutex
+	persons       []*memoryPerson
+	registrations []*memoryRegistration
+	lastHN        map[uuid.UUID]int
+	lastCreatedAt time.Time
+
+	// fuzzyThreshold plays the part of pg_trgm.similarity_threshold, above
+	// which the % operator considers two names similar.
+	fuzzyThreshold float64
+}
+
+// memoryPerson holds the details of a person, without the phone number and
+// email, which are the registration's.
+type memoryPerson struct {
+	id      uuid.UUID
+	details models.CreatePatientRequest
+}
+
+type memoryRegistration struct {
+	id          uuid.UUID
+	person      *memoryPerson
+	hospitalID  uuid.UUID
+	patientHN   string
+	phoneNumber string
+	email       string
+	createdAt   time.Time
+	deleted     bool
+}
+
+// NewMemoryPatientRepository returns an empty repository whose fuzzy search
+// matches names as similar as fuzzyThreshold, as Search.FuzzyThreshold does
+// for PostgresPatientRepository.
+func NewMemoryPatientRepository(fuzzyThreshold float64) *MemoryPatientRepository {
+	return &MemoryPatientRepository{lastHN: make(map[uuid.UUID]int), fuzzyThreshold: fuzzyThreshold}
+}
+
+// patient returns the registration as the patient queries select it.
+func (reg *memoryRegistration) patient() *models.Patient {
+	d := reg.person.details
+	p := &models.Patient{
+		ID:           reg.id,
+		PatientHN:    reg.patientHN,
+		FirstNameTH:  models.NullString(d.FirstNameTH),
+		MiddleNameTH: models.NullString(d.MiddleNameTH),
+		LastNameTH:   models.NullString(d.LastNameTH),
+		FirstNameEN:  models.NullString(d.FirstNameEN),
+		MiddleNameEN: models.NullString(d.MiddleNameEN),
+		LastNameEN:   models.NullString(d.LastNameEN),
+		Gender:       models.NullString(d.Gender),
+		NationalID:   models.NullString(d.NationalID),
+		PassportID:   models.NullString(d.PassportID),
+		PhoneNumber:  models.NullString(reg.phoneNumber),
+		Email:        models.NullString(reg.email),
+		HospitalID:   reg.hospitalID,
+	}
+	if dob, err := time.Parse("2006-01-02", d.DateOfBirth); err == nil {
+		p.DateOfBirth = &models.Date{Time: dob}
+	}
+	return p
+}
+
+// sortValue returns the value a registration sorts by, as text that orders
+// like the value itself.
+func (reg *memoryRegistration) sortValue(sort string, score float64) string {
+	switch sort {
+	case SortCreatedAt:
+		return reg.createdAt.Format(memorySortTime)
+	case SortDateOfBirth:
+		if reg.person.details.DateOfBirth == "" {
+			return "0001-01-01"
+		}
+		return reg.person.details.DateOfBirth
+	case SortFirstNameEN:
+		return reg.person.details.FirstNameEN
+	case SortLastNameEN:
+		return reg.person.details.LastNameEN
+	}
+	// Scores lie between 0 and 1, so a fixed number of decimals sorts.
+	return strconv.FormatFloat(score, 'f', 8, 64)
+}
+
+// match reports whether a live registration matches the filter, and for a
+// fuzzy name filter its mean name similarity. Fuzzy names match from
+// fuzzyThreshold up.
+func (reg *memoryRegistration) match(hospitalID uuid.UUID, filter PatientFilter, fuzzyThreshold float64) (bool, float64) {
+	d := reg.person.details
+	if reg.deleted || reg.hospitalID != hospitalID {
+		return false, 0
+	}
+
+	for _, exact := range []struct{ column, value string }{
+		{reg.patientHN, filter.PatientHN},
+		{d.NationalID, filter.NationalID},
+		{d.PassportID, filter.PassportID},
+		{d.DateOfBirth, filter.DateOfBirth},
+	} {
+		if exact.value != "" && exact.column != exact.value {
+			return false, 0
+		}
+	}
+
+	var scores []float64
+	for _, name := range []struct{ value, en, th string }{
+		{filter.FirstName, d.FirstNameEN, d.FirstNameTH},
+		{filter.MiddleName, d.MiddleNameEN, d.MiddleNameTH},
+		{filter.LastName, d.LastNameEN, d.LastNameTH},
+	} {
+		if name.value == "" {
+			continue
+		}
+
+		if filter.Fuzzy {
+			en, th := similarity(name.en, name.value), similarity(name.th, name.value)
+			if en < fuzzyThreshold && th < fuzzyThreshold {
+				return false, 0
+			}
+			scores = append(scores, max(en, th))
+		} else if !containsFold(name.en, name.value) && !containsFold(name.th, name.value) {
+			return false, 0
+		}
+	}
+
+	if filter.Family != "" && !hasPrefixFold(d.LastNameEN, filter.Family) && !hasPrefixFold(d.LastNameTH, filter.Family) {
+		return false, 0
+	}
+	if filter.Given != "" && !slices.ContainsFunc(
+		[]string{d.FirstNameEN, d.FirstNameTH, d.MiddleNameEN, d.MiddleNameTH},
+		func(name string) bool { return hasPrefixFold(name, filter.Given) },
+	) {
+		return false, 0
+	}
+
+	var score float64
+	for _, s := range scores {
+		score += s / float64(len(scores))
+	}
+	return true, score
+}
+
+// memorySearchRow is a matching registration with its sort value.
+type memorySearchRow struct {
+	reg   *memoryRegistration
+	value string
+	score float64
+}
+
+func (r *MemoryPatientRepository) Search(ctx context.Context, search PatientSearch) (*PatientPage, error) {
+	if search.Sort == SortScore && !search.Filter.Fuzzy {
+		return nil, fmt.Errorf("unable to sort patients by %q", search.Sort)
+	}
+	if _, ok := patientSorts[search.Sort]; !ok && search.Sort != SortScore {
+		return nil, fmt.Errorf("unable to sort patients by %q", search.Sort)
+	}
+	hospitalID, err := uuid.Parse(search.Filter.HospitalID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search patients: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows []memorySearchRow
+	for _, reg := range r.registrations {
+		if ok, score := reg.match(hospitalID, search.Filter, r.fuzzyThreshold); ok {
+			rows = append(rows, memorySearchRow{reg: reg, value: reg.sortValue(search.Sort, score), score: score})
+		}
+	}
+
+	compare := func(value string, id uuid.UUID, row memorySearchRow) int {
+		c := strings.Compare(value, row.value)
+		if c == 0 {
+			c = bytes.Compare(id[:], row.reg.id[:])
+		}
+		if search.Descending {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(rows, func(a, b memorySearchRow) int { return compare(a.value, a.reg.id, b) })
+	if search.After != nil {
+		rows = slices.DeleteFunc(rows, func(row memorySearchRow) bool {
+			return compare(search.After.Value, search.After.ID, row) >= 0
+		})
+	}
+
+	page := &PatientPage{Patients: []*models.Patient{}}
+	if len(rows) > search.Limit {
+		rows = rows[:search.Limit]
+		last := rows[search.Limit-1]
+		page.Next = &PatientCursor{Value: last.value, ID: last.reg.id}
+	}
+	for _, row := range rows {
+		p := row.reg.patient()
+		if search.Filter.Fuzzy {
+			p.Score = &row.score
+		}
+		page.Patients = append(page.Patients, p)
+	}
+	return page, nil
+}
+
+func (r *MemoryPatientRepository) List(ctx context.Context, filter PatientFilter, offset int, limit int) ([]*models.Patient, error) {
+	matched, err := r.matching(filter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list patients: %w", err)
+	}
+
+	// Registrations are kept in creation order.
+	patients := []*models.Patient{}
+	for _, reg := range matched[min(offset, len(matched)):min(offset+limit, len(matched))] {
+		patients = append(patients, reg.patient())
+	}
+	return patients, nil
+}
+
+func (r *MemoryPatientRepository) Count(ctx context.Context, filter PatientFilter) (int64, error) {
+	matched, err := r.matching(filter)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count patients: %w", err)
+	}
+	return int64(len(matched)), nil
+}
+
+// matching returns the registrations matching the filter, oldest first.
+func (r *MemoryPatientRepository) matching(filter PatientFilter) ([]*memoryRegistration, error) {
+	hospitalID, err := uuid.Parse(filter.HospitalID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []*memoryRegistration
+	for _, reg := range r.registrations {
+		if ok, _ := reg.match(hospitalID, filter, r.fuzzyThreshold); ok {
+			matched = append(matched, reg)
+		}
+	}
+	return matched, nil
+}
+
+func (r *MemoryPatientRepository) GetByID(ctx context.Context, hospitalID string, id uuid.UUID) (*models.Patient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg := r.live(hospitalID, id)
+	if reg == nil {
+		return nil, ErrNotFound
+	}
+	return reg.patient(), nil
+}
+
+func (r *MemoryPatientRepository) GetByNationalID(ctx context.Context, hospitalID string, nationalID string) (*models.Patient, error) {
+	return r.getByIdentifier(hospitalID, func(d models.CreatePatientRequest) bool { return nationalID != "" && d.NationalID == nationalID })
+}
+
+func (r *MemoryPatientRepository) GetByPassportID(ctx context.Context, hospitalID string, passportID string) (*models.Patient, error) {
+	return r.getByIdentifier(hospitalID, func(d models.CreatePatientRequest) bool { return passportID != "" && d.PassportID == passportID })
+}
+
+// getByIdentifier prefers the registration at the given hospital and falls
+// back to any other.
+func (r *MemoryPatientRepository) getByIdentifier(hospitalID string, identifies func(models.CreatePatientRequest) bool) (*models.Patient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found *memoryRegistration
+	for _, reg := range r.registrations {
+		if reg.deleted || !identifies(reg.person.details) {
+			continue
+		}
+		if reg.hospitalID.String() == hospitalID {
+			return reg.patient(), nil
+		}
+		if found == nil {
+			found = reg
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found.patient(), nil
+}
+
+func (r *MemoryPatientRepository) Create(ctx context.Context, hospitalID string, input *models.CreatePatientRequest) (*models.Patient, error) {
+	hospital, err := uuid.Parse(hospitalID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create patient: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	details := *input
+	details.PhoneNumber, details.Email = "", ""
+
+	// The person already known under the national ID or, without one, the
+	// passport is registered again if the details match; anyone else is a
+	// new person.
+	var person *memoryPerson
+	for _, p := range r.persons {
+		if input.NationalID != "" && p.details.NationalID == input.NationalID ||
+			input.NationalID == "" && input.PassportID != "" && p.details.PassportID == input.PassportID {
+			if p.details != details {
+				return nil, ErrPersonMismatch
+			}
+			person = p
+			break
+		}
+	}
+	if person == nil {
+		person = &memoryPerson{id: uuid.New(), details: details}
+		if err := r.checkPerson(person.id, person.details); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, reg := range r.registrations {
+		if reg.person == person && reg.hospitalID == hospital && !reg.deleted {
+			return nil, ErrAlreadyRegistered
+		}
+	}
+	if err := r.checkEmail(hospital, uuid.Nil, input.Email); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(r.persons, person) {
+		r.persons = append(r.persons, person)
+	}
+
+	r.lastHN[hospital]++
+	reg := &memoryRegistration{
+		id:          uuid.New(),
+		person:      person,
+		hospitalID:  hospital,
+		patientHN:   fmt.Sprintf("HN%08d", r.lastHN[hospital]),
+		phoneNumber: input.PhoneNumber,
+		email:       input.Email,
+		createdAt:   r.now(),
+	}
+	r.registrations = append(r.registrations, reg)
+	return reg.patient(), nil
+}
+
+func (r *MemoryPatientRepository) Update(ctx context.Context, hospitalID string, id uuid.UUID, input *models.UpdatePatientRequest) (*models.Patient, error) {
+	if input.IsEmpty() {
+		return nil, errors.New("no fields to update")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg := r.live(hospitalID, id)
+	if reg == nil {
+		return nil, ErrNotFound
+	}
+
+	details := reg.person.details
+	for _, field := range []struct {
+		column *string
+		value  *string
+	}{
+		{&details.FirstNameTH, input.FirstNameTH},
+		{&details.MiddleNameTH, input.MiddleNameTH},
+		{&details.LastNameTH, input.LastNameTH},
+		{&details.FirstNameEN, input.FirstNameEN},
+		{&details.MiddleNameEN, input.MiddleNameEN},
+		{&details.LastNameEN, input.LastNameEN},
+		{&details.DateOfBirth, input.DateOfBirth},
+		{&details.Gender, input.Gender},
+		{&details.NationalID, input.NationalID},
+		{&details.PassportID, input.PassportID},
+	} {
+		if field.value != nil {
+			*field.column = *field.value
+		}
+	}
+	if err := r.checkPerson(reg.person.id, details); err != nil {
+		return nil, err
+	}
+	if details != reg.person.details && slices.ContainsFunc(r.registrations, func(other *memoryRegistration) bool {
+		return other.person == reg.person && other.hospitalID != reg.hospitalID && !other.deleted
+	}) {
+		return nil, ErrSharedPerson
+	}
+
+	phoneNumber, email := reg.phoneNumber, reg.email
+	if input.PhoneNumber != nil {
+		phoneNumber = *input.PhoneNumber
+	}
+	if input.Email != nil {
+		email = *input.Email
+	}
+	if err := r.checkEmail(reg.hospitalID, reg.id, email); err != nil {
+		return nil, err
+	}
+
+	reg.person.details = details
+	reg.phoneNumber, reg.email = phoneNumber, email
+	return reg.patient(), nil
+}
+
+func (r *MemoryPatientRepository) Delete(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg := r.live(hospitalID, id)
+	if reg == nil {
+		return ErrNotFound
+	}
+	reg.deleted = true
+	return nil
+}
+
+// live returns the live registration id at the hospital, or nil.
+func (r *MemoryPatientRepository) live(hospitalID string, id uuid.UUID) *memoryRegistration {
+	for _, reg := range r.registrations {
+		if reg.id == id && reg.hospitalID.String() == hospitalID && !reg.deleted {
+			return reg
+		}
+	}
+	return nil
+}
+
+// checkPerson enforces chk_persons_identifier and the unique indexes on
+// persons for the details of person id.
+func (r *MemoryPatientRepository) checkPerson(id uuid.UUID, details models.CreatePatientRequest) error {
+	if details.NationalID == "" && details.PassportID == "" {
+		return ErrIdentifierRequired
+	}
+	for _, p := range r.persons {
+		if p.id == id {
+			continue
+		}
+		for _, unique := range []struct{ field, value, taken string }{
+			{"national_id", details.NationalID, p.details.NationalID},
+			{"passport_id", details.PassportID, p.details.PassportID},
+		} {
+			if unique.value != "" && unique.value == unique.taken {
+				return &DuplicateError{Field: unique.field}
+			}
+		}
+	}
+	return nil
+}
+
+// checkEmail enforces uq_patients_hospital_email for registration id at the
+// hospital.
+func (r *MemoryPatientRepository) checkEmail(hospitalID uuid.UUID, id uuid.UUID, email string) error {
+	if email == "" {
+		return nil
+	}
+	for _, reg := range r.registrations {
+		if reg.id != id && reg.hospitalID == hospitalID && !reg.deleted && reg.email == email {
+			return &DuplicateError{Field: "email"}
+		}
+	}
+	return nil
+}
+
+// now returns the creation time of a new registration, truncated like a
+// timestamptz and after every earlier one so that creation order is stable.
+func (r *MemoryPatientRepository) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(r.lastCreatedAt) {
+		now = r.lastCreatedAt.Add(time.Microsecond)
+	}
+	r.lastCreatedAt = now
+	return now
+}
+
+// similarity computes pg_trgm's similarity: the share of trigrams two strings
+// have in common, where each word is padded with two spaces in front and one
+// behind.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		// Thai vowels and tone marks are non-spacing marks within a word.
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
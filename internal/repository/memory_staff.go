@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryRolePermissions are the roles and their permissions as seeded by
+// migration 0004.
+var memoryRolePermissions = map[string][]string{
+	"hospital_admin": {"audit:read", "patient:read", "patient:write", "staff:create", "staff:deactivate"},
+	"clerk":          {"patient:read", "patient:write"},
+	"doctor":         {"patient:read"},
+	"auditor":        {"audit:read"},
+}
+
+// MemoryStaffRepository keeps the staff of a fixed set of hospitals and their
+// sessions in memory, for tests that need the behavior of
+// PostgresStaffRepository without a database.
+type MemoryStaffRepository struct {
+	mu            sync.Mutex
+	hospitals     []models.Hospital
+	staff         []*models.Staff
+	refreshTokens map[string]*memoryRefreshToken
+	revokedJTIs   map[string]time.Time
+}
+
+type memoryRefreshToken struct {
+	staffID   uuid.UUID
+	familyID  uuid.UUID
+	expiresAt time.Time
+	revoked   bool
+}
+
+func NewMemoryStaffRepository(hospitals ...models.Hospital) *MemoryStaffRepository {
+	return &MemoryStaffRepository{
+		hospitals:     hospitals,
+		refreshTokens: make(map[string]*memoryRefreshToken),
+		revokedJTIs:   make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryStaffRepository) GetActive(ctx context.Context, username string, hospitalCode string) (*models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.staff {
+		if s.Username == username && s.Hospital == hospitalCode && s.IsActive {
+			return &models.Staff{
+				ID:           s.ID,
+				Username:     s.Username,
+				PasswordHash: s.PasswordHash,
+				HospitalID:   s.HospitalID,
+				Hospital:     s.Hospital,
+				IsActive:     true,
+			}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryStaffRepository) Create(ctx context.Context, hospitalID string, username string, passwordHash string, roles []string) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.hospitals, func(h models.Hospital) bool { return h.ID.String() == hospitalID })
+	if i < 0 {
+		return uuid.Nil, fmt.Errorf("unable to create staff: unknown hospital %s", hospitalID)
+	}
+	if slices.ContainsFunc(r.staff, func(s *models.Staff) bool { return s.Username == username }) {
+		return uuid.Nil, fmt.Errorf("unable to create staff: username is taken")
+	}
+
+	// Like the insert into staff_roles, unknown role names are skipped.
+	var known []string
+	for _, role := range roles {
+		if _, ok := memoryRolePermissions[role]; ok && !slices.Contains(known, role) {
+			known = append(known, role)
+		}
+	}
+
+	s := &models.Staff{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		HospitalID:   r.hospitals[i].ID,
+		Hospital:     r.hospitals[i].Code,
+		IsActive:     true,
+		Roles:        known,
+		CreatedAt:    time.Now(),
+	}
+	r.staff = append(r.staff, s)
+	return s.ID, nil
+}
+
+func (r *MemoryStaffRepository) Deactivate(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.staff {
+		if s.ID == id && s.HospitalID.String() == hospitalID && s.IsActive {
+			s.IsActive = false
+			for _, token := range r.refreshTokens {
+				if token.staffID == id {
+					token.revoked = true
+				}
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryStaffRepository) Access(ctx context.Context, staffID uuid.UUID) ([]string, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles, permissions := []string{}, []string{}
+	for _, s := range r.staff {
+		if s.ID != staffID {
+			continue
+		}
+		for _, role := range s.Roles {
+			roles = append(roles, role)
+			permissions = append(permissions, memoryRolePermissions[role]...)
+		}
+	}
+
+	// array_agg(DISTINCT ...) returns sorted, distinct names.
+	slices.Sort(roles)
+	slices.Sort(permissions)
+	return slices.Compact(roles), slices.Compact(permissions), nil
+}
+
+func (r *MemoryStaffRepository) StoreRefreshToken(ctx context.Context, staffID uuid.UUID, familyID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.refreshTokens[tokenHash]; ok {
+		return fmt.Errorf("unable to store refresh token: duplicate token hash")
+	}
+	maps.DeleteFunc(r.refreshTokens, func(_ string, token *memoryRefreshToken) bool {
+		return !token.expiresAt.After(time.Now())
+	})
+	r.refreshTokens[tokenHash] = &memoryRefreshToken{staffID: staffID, familyID: familyID, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *MemoryStaffRepository) RotateRefreshToken(ctx context.Context, tokenHash string) (*RefreshSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refreshTokens[tokenHash]
+	if !ok || token.revoked || !token.expiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	i := slices.IndexFunc(r.staff, func(s *models.Staff) bool { return s.ID == token.staffID && s.IsActive })
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	token.revoked = true
+	s := r.staff[i]
+	return &RefreshSession{
+		StaffID:  token.staffID,
+		FamilyID: token.familyID,
+		Hospital: models.Hospital{ID: s.HospitalID, Code: s.Hospital},
+	}, nil
+}
+
+func (r *MemoryStaffRepository) RevokeReusedRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refreshTokens[tokenHash]
+	if !ok || !token.revoked {
+		return 0, nil
+	}
+	return r.revokeFamily(token.familyID), nil
+}
+
+func (r *MemoryStaffRepository) RevokeSession(ctx context.Context, staffID string, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token, ok := r.refreshTokens[tokenHash]; ok && token.staffID.String() == staffID {
+		r.revokeFamily(token.familyID)
+	}
+	return nil
+}
+
+func (r *MemoryStaffRepository) RevokeAccessToken(ctx context.Context, jti string, staffID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maps.DeleteFunc(r.revokedJTIs, func(_ string, expiresAt time.Time) bool {
+		return !expiresAt.After(time.Now())
+	})
+	if _, ok := r.revokedJTIs[jti]; !ok {
+		r.revokedJTIs[jti] = expiresAt
+	}
+	return nil
+}
+
+func (r *MemoryStaffRepository) IsAccessRevoked(ctx context.Context, jti string, staffID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.revokedJTIs[jti]; ok {
+		return true, nil
+	}
+	for _, s := range r.staff {
+		if s.ID.String() == staffID && s.IsActive {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// revokeFamily revokes the live tokens of a session and returns how many it
+// revoked.
+func (r *MemoryStaffRepository) revokeFamily(familyID uuid.UUID) int64 {
+	var revoked int64
+	for _, token := range r.refreshTokens {
+		if token.familyID == familyID && !token.revoked {
+			token.revoked = true
+			revoked++
+		}
+	}
+	return revoked
+}
@@ -0,0 +1,358 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ repository.PatientRepository = (*repository.MemoryPatientRepository)(nil)
+	_ repository.StaffRepository   = (*repository.MemoryStaffRepository)(nil)
+	_ repository.AuditRepository   = (*repository.MemoryAuditRepository)(nil)
+)
+
+const otherHospitalID = "6f1c1a52-0000-4000-8000-000000000002"
+
+// fuzzyThreshold is the default Search.FuzzyThreshold.
+const fuzzyThreshold = 0.25
+
+// register creates a patient at the hospital, failing the test on error.
+func register(t *testing.T, repo *repository.MemoryPatientRepository, hospitalID string, input models.CreatePatientRequest) *models.Patient {
+	t.Helper()
+	p, err := repo.Create(context.Background(), hospitalID, &input)
+	require.NoError(t, err)
+	return p
+}
+
+func TestMemoryPatientRegistration(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Numbers Patients Per Hospital", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		first := register(t, repo, testHospitalID, models.CreatePatientRequest{FirstNameEN: "Anna", NationalID: "1234567890121"})
+		second := register(t, repo, testHospitalID, models.CreatePatientRequest{FirstNameEN: "Ben", PassportID: "AB123456"})
+		other := register(t, repo, otherHospitalID, models.CreatePatientRequest{FirstNameEN: "Cara", PassportID: "CD123456"})
+
+		assert.Equal(t, "HN00000001", first.PatientHN)
+		assert.Equal(t, "HN00000002", second.PatientHN)
+		assert.Equal(t, "HN00000001", other.PatientHN)
+	})
+
+	t.Run("Person Shared Between Hospitals", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		phone := "+66812345678"
+		atFirst := register(t, repo, testHospitalID, models.CreatePatientRequest{FirstNameEN: "Anna", NationalID: "1234567890121", PhoneNumber: phone})
+
+		// Registering a known person needs their exact details
+		_, err := repo.Create(ctx, otherHospitalID, &models.CreatePatientRequest{FirstNameEN: "Ann", NationalID: "1234567890121"})
+		assert.ErrorIs(t, err, repository.ErrPersonMismatch)
+		atOther := register(t, repo, otherHospitalID, models.CreatePatientRequest{FirstNameEN: "Anna", NationalID: "1234567890121"})
+		assert.NotEqual(t, atFirst.ID, atOther.ID)
+		assert.Empty(t, atOther.PhoneNumber)
+
+		// Contact details belong to the registration
+		changed := "+66899999999"
+		_, err = repo.Update(ctx, testHospitalID, atFirst.ID, &models.UpdatePatientRequest{PhoneNumber: &changed})
+		require.NoError(t, err)
+		p, err := repo.GetByID(ctx, otherHospitalID, atOther.ID)
+		require.NoError(t, err)
+		assert.Empty(t, p.PhoneNumber)
+
+		// The person's details are shared, so neither hospital changes them
+		name := "Anne"
+		_, err = repo.Update(ctx, testHospitalID, atFirst.ID, &models.UpdatePatientRequest{FirstNameEN: &name})
+		assert.ErrorIs(t, err, repository.ErrSharedPerson)
+		p, err = repo.GetByID(ctx, otherHospitalID, atOther.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.NullString("Anna"), p.FirstNameEN)
+
+		// Unless the other registration is gone
+		require.NoError(t, repo.Delete(ctx, otherHospitalID, atOther.ID))
+		p, err = repo.Update(ctx, testHospitalID, atFirst.ID, &models.UpdatePatientRequest{FirstNameEN: &name})
+		require.NoError(t, err)
+		assert.Equal(t, models.NullString(name), p.FirstNameEN)
+	})
+
+	t.Run("Hospital Isolation", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		p := register(t, repo, testHospitalID, models.CreatePatientRequest{FirstNameEN: "Anna", NationalID: "1234567890121"})
+
+		_, err := repo.GetByID(ctx, otherHospitalID, p.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, otherHospitalID, p.ID), repository.ErrNotFound)
+
+		// Lookups by identifier fall back to other hospitals
+		found, err := repo.GetByNationalID(ctx, otherHospitalID, "1234567890121")
+		require.NoError(t, err)
+		assert.Equal(t, p.ID, found.ID)
+		assert.Equal(t, uuid.MustParse(testHospitalID), found.HospitalID)
+	})
+
+	t.Run("Unique Constraints", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		register(t, repo, testHospitalID, models.CreatePatientRequest{NationalID: "1234567890121", PassportID: "AB123456", Email: "anna@example.com"})
+
+		var duplicate *repository.DuplicateError
+		_, err := repo.Create(ctx, testHospitalID, &models.CreatePatientRequest{NationalID: "1111111111119", PassportID: "AB123456"})
+		require.ErrorAs(t, err, &duplicate)
+		assert.Equal(t, "passport_id", duplicate.Field)
+
+		_, err = repo.Create(ctx, testHospitalID, &models.CreatePatientRequest{PassportID: "XY123456", Email: "anna@example.com"})
+		require.ErrorAs(t, err, &duplicate)
+		assert.Equal(t, "email", duplicate.Field)
+
+		_, err = repo.Create(ctx, testHospitalID, &models.CreatePatientRequest{NationalID: "1234567890121", PassportID: "AB123456"})
+		assert.ErrorIs(t, err, repository.ErrAlreadyRegistered)
+
+		// Email is unique per hospital
+		register(t, repo, otherHospitalID, models.CreatePatientRequest{PassportID: "ZZ123456", Email: "anna@example.com"})
+
+		// Neither failed registration left a person behind
+		p := register(t, repo, testHospitalID, models.CreatePatientRequest{PassportID: "XY123456"})
+		assert.Equal(t, "HN00000002", p.PatientHN)
+	})
+
+	t.Run("Registered Again After Delete", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		p := register(t, repo, testHospitalID, models.CreatePatientRequest{NationalID: "1234567890121"})
+		require.NoError(t, repo.Delete(ctx, testHospitalID, p.ID))
+
+		_, err := repo.GetByNationalID(ctx, testHospitalID, "1234567890121")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		again := register(t, repo, testHospitalID, models.CreatePatientRequest{NationalID: "1234567890121"})
+		assert.NotEqual(t, p.ID, again.ID)
+	})
+
+	t.Run("Identifier Required", func(t *testing.T) {
+		repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+		p := register(t, repo, testHospitalID, models.CreatePatientRequest{NationalID: "1234567890121"})
+
+		empty := ""
+		_, err := repo.Update(ctx, testHospitalID, p.ID, &models.UpdatePatientRequest{NationalID: &empty})
+		assert.ErrorIs(t, err, repository.ErrIdentifierRequired)
+
+		// The failed update changed nothing
+		found, err := repo.GetByID(ctx, testHospitalID, p.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.NullString("1234567890121"), found.NationalID)
+	})
+}
+
+func TestMemoryPatientSearch(t *testing.T) {
+	ctx := context.Background()
+
+	repo := repository.NewMemoryPatientRepository(fuzzyThreshold)
+	somchai := register(t, repo, testHospitalID, models.CreatePatientRequest{
+		FirstNameEN: "Somchai", LastNameEN: "Jaidee", FirstNameTH: "สมชาย", LastNameTH: "ใจดี",
+		NationalID: "1234567890121", DateOfBirth: "1980-01-01",
+	})
+	somsri := register(t, repo, testHospitalID, models.CreatePatientRequest{
+		FirstNameEN: "Somsri", LastNameEN: "Rakthai", NationalID: "1111111111119", DateOfBirth: "1975-05-05",
+	})
+	john := register(t, repo, testHospitalID, models.CreatePatientRequest{
+		FirstNameEN: "John", LastNameEN: "Doe", PassportID: "AB123456",
+	})
+	register(t, repo, otherHospitalID, models.CreatePatientRequest{FirstNameEN: "Somchai", PassportID: "CD123456"})
+
+	search := func(filter repository.PatientFilter, sort string, descending bool) []uuid.UUID {
+		t.Helper()
+		filter.HospitalID = testHospitalID
+		page, err := repo.Search(ctx, repository.PatientSearch{Filter: filter, Sort: sort, Descending: descending, Limit: 10})
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, len(page.Patients))
+		for i, p := range page.Patients {
+			ids[i] = p.ID
+		}
+		return ids
+	}
+
+	t.Run("Contains Either Language", func(t *testing.T) {
+		assert.Equal(t, []uuid.UUID{somchai.ID, somsri.ID}, search(repository.PatientFilter{FirstName: "SOM"}, repository.SortCreatedAt, false))
+		assert.Equal(t, []uuid.UUID{somchai.ID}, search(repository.PatientFilter{LastName: "ใจ"}, repository.SortCreatedAt, false))
+	})
+
+	t.Run("Exact Fields", func(t *testing.T) {
+		assert.Equal(t, []uuid.UUID{somsri.ID}, search(repository.PatientFilter{DateOfBirth: "1975-05-05"}, repository.SortCreatedAt, false))
+		assert.Equal(t, []uuid.UUID{john.ID}, search(repository.PatientFilter{PassportID: "AB123456"}, repository.SortCreatedAt, false))
+		assert.Empty(t, search(repository.PatientFilter{PassportID: "CD123456"}, repository.SortCreatedAt, false))
+	})
+
+	t.Run("Family And Given Prefixes", func(t *testing.T) {
+		assert.Equal(t, []uuid.UUID{somchai.ID}, search(repository.PatientFilter{Family: "jai"}, repository.SortCreatedAt, false))
+		assert.Empty(t, search(repository.PatientFilter{Family: "dee"}, repository.SortCreatedAt, false))
+		assert.Equal(t, []uuid.UUID{john.ID}, search(repository.PatientFilter{Given: "jo"}, repository.SortCreatedAt, false))
+	})
+
+	t.Run("Fuzzy", func(t *testing.T) {
+		fuzzy := repository.PatientSearch{
+			Filter:     repository.PatientFilter{HospitalID: testHospitalID, FirstName: "Somchay", Fuzzy: true},
+			Sort:       repository.SortScore,
+			Descending: true,
+			Limit:      10,
+		}
+		page, err := repo.Search(ctx, fuzzy)
+		require.NoError(t, err)
+
+		// Somchai and Somchay share 6 of their 10 trigrams, Somsri and
+		// Somchay 3 of their 12
+		require.Len(t, page.Patients, 2)
+		assert.Equal(t, somchai.ID, page.Patients[0].ID)
+		assert.InDelta(t, 0.6, *page.Patients[0].Score, 1e-9)
+		assert.Equal(t, somsri.ID, page.Patients[1].ID)
+		assert.InDelta(t, 0.25, *page.Patients[1].Score, 1e-9)
+
+		// Somsri falls below a higher threshold
+		strict := repository.NewMemoryPatientRepository(0.3)
+		register(t, strict, testHospitalID, models.CreatePatientRequest{FirstNameEN: "Somsri", NationalID: "1111111111119"})
+		page, err = strict.Search(ctx, fuzzy)
+		require.NoError(t, err)
+		assert.Empty(t, page.Patients)
+	})
+
+	t.Run("Sorted Pages", func(t *testing.T) {
+		filter := repository.PatientFilter{HospitalID: testHospitalID}
+		var seen []uuid.UUID
+		var after *repository.PatientCursor
+		for {
+			page, err := repo.Search(ctx, repository.PatientSearch{
+				Filter: filter, Sort: repository.SortDateOfBirth, Descending: true, After: after, Limit: 2,
+			})
+			require.NoError(t, err)
+			for _, p := range page.Patients {
+				seen = append(seen, p.ID)
+			}
+			if page.Next == nil {
+				break
+			}
+			after = page.Next
+		}
+
+		// Missing dates of birth sort as the earliest
+		assert.Equal(t, []uuid.UUID{somchai.ID, somsri.ID, john.ID}, seen)
+	})
+
+	t.Run("List And Count", func(t *testing.T) {
+		filter := repository.PatientFilter{HospitalID: testHospitalID}
+		total, err := repo.Count(ctx, filter)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+
+		patients, err := repo.List(ctx, filter, 1, 5)
+		require.NoError(t, err)
+		require.Len(t, patients, 2)
+		assert.Equal(t, somsri.ID, patients[0].ID)
+	})
+}
+
+func TestMemoryStaffSessions(t *testing.T) {
+	ctx := context.Background()
+	hospital := models.Hospital{ID: uuid.MustParse(testHospitalID), Code: "hn-001"}
+	repo := repository.NewMemoryStaffRepository(hospital)
+
+	staffID, err := repo.Create(ctx, testHospitalID, "nurse", "hash", []string{"doctor", "clerk", "superuser"})
+	require.NoError(t, err)
+
+	roles, permissions, err := repo.Access(ctx, staffID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"clerk", "doctor"}, roles)
+	assert.Equal(t, []string{"patient:read", "patient:write"}, permissions)
+
+	_, err = repo.Create(ctx, testHospitalID, "nurse", "hash", nil)
+	assert.Error(t, err)
+
+	familyID := uuid.New()
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, repo.StoreRefreshToken(ctx, staffID, familyID, "first", expiresAt))
+
+	session, err := repo.RotateRefreshToken(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, familyID, session.FamilyID)
+	assert.Equal(t, hospital.Code, session.Hospital.Code)
+	require.NoError(t, repo.StoreRefreshToken(ctx, staffID, familyID, "second", expiresAt))
+
+	// Presenting the rotated token again revokes the whole session
+	_, err = repo.RotateRefreshToken(ctx, "first")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	revoked, err := repo.RevokeReusedRefreshToken(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	_, err = repo.RotateRefreshToken(ctx, "second")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	// Logging out revokes the access token alone
+	require.NoError(t, repo.RevokeAccessToken(ctx, "first-jti", staffID.String(), expiresAt))
+	for jti, want := range map[string]bool{"first-jti": true, "second-jti": false} {
+		revoked, err := repo.IsAccessRevoked(ctx, jti, staffID.String())
+		require.NoError(t, err)
+		assert.Equal(t, want, revoked, jti)
+	}
+
+	// Expired entries are pruned when the next token is revoked
+	require.NoError(t, repo.RevokeAccessToken(ctx, "expired-jti", staffID.String(), time.Now().Add(-time.Minute)))
+	require.NoError(t, repo.RevokeAccessToken(ctx, "third-jti", staffID.String(), expiresAt))
+	pruned, err := repo.IsAccessRevoked(ctx, "expired-jti", staffID.String())
+	require.NoError(t, err)
+	assert.False(t, pruned)
+
+	// Deactivating the staff member revokes all their access tokens
+	require.NoError(t, repo.Deactivate(ctx, testHospitalID, staffID))
+	revokedAccess, err := repo.IsAccessRevoked(ctx, "second-jti", staffID.String())
+	require.NoError(t, err)
+	assert.True(t, revokedAccess)
+	_, err = repo.GetActive(ctx, "nurse", "hn-001")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, repo.Deactivate(ctx, testHospitalID, staffID), repository.ErrNotFound)
+}
+
+func TestMemoryAuditTrail(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryAuditRepository()
+
+	patientID := uuid.New()
+	for _, action := range []string{"patient.create", "patient.read", "patient.search"} {
+		require.NoError(t, repo.Record(ctx, repository.AuditRecord{
+			HospitalID: testHospitalID,
+			Action:     action,
+			PatientIDs: []uuid.UUID{patientID},
+		}))
+	}
+	require.NoError(t, repo.Record(ctx, repository.AuditRecord{HospitalID: otherHospitalID, Action: "patient.read"}))
+
+	events, more, err := repo.List(ctx, repository.AuditFilter{HospitalID: testHospitalID, PatientID: &patientID}, 2)
+	require.NoError(t, err)
+	assert.True(t, more)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(3), events[0].Seq)
+
+	events, more, err = repo.List(ctx, repository.AuditFilter{HospitalID: testHospitalID, BeforeSeq: events[1].Seq}, 2)
+	require.NoError(t, err)
+	assert.False(t, more)
+	require.Len(t, events, 1)
+	assert.Equal(t, "patient.create", events[0].Action)
+
+	result, err := repo.Verify(ctx, testHospitalID)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(3), result.Events)
+
+	repo.Tamper(2, func(e *models.AuditEvent) { e.Action = "patient.search" })
+	result, err = repo.Verify(ctx, testHospitalID)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(2), *result.FirstInvalidSeq)
+
+	// Other hospitals only hear about their own events
+	result, err = repo.Verify(ctx, otherHospitalID)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(1), result.Events)
+}
@@ -0,0 +1,489 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"agnos_demo/internal/database"
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// A patient is the registration r of a person p at a hospital. Queries alias
+// the two tables that way so patientColumns can be selected from either. The
+// contact details are the registration's, the rest the person's.
+const (
+	patientColumns = `r.id, r.patient_hn, p.first_name_th, p.middle_name_th, p.last_name_th, p.first_name_en, p.middle_name_en, p.last_name_en,
+	p.date_of_birth, p.gender, p.national_id, p.passport_id, r.phone_number, r.email, r.hospital_id`
+	patientTables = `patients r JOIN persons p ON p.id = r.person_id`
+
+	// personColumns are the columns of persons, in table order.
+	personColumns = `id, first_name_th, middle_name_th, last_name_th, first_name_en, middle_name_en, last_name_en,
+	date_of_birth, national_id, passport_id, gender, created_at, updated_at`
+
+	// personDetails are the columns of persons a registration must agree on.
+	personDetails = `first_name_th, middle_name_th, last_name_th, first_name_en, middle_name_en, last_name_en,
+	date_of_birth, gender, national_id, passport_id`
+)
+
+// patientSort is the expression a sort key orders by. Pages are fetched with
+// a keyset on (expr, r.id), so expr must be non-NULL.
+type patientSort struct {
+	expr string
+	cast string
+}
+
+var patientSorts = map[string]patientSort{
+	SortCreatedAt:   {expr: "r.created_at", cast: "timestamptz"},
+	SortDateOfBirth: {expr: "COALESCE(p.date_of_birth, '0001-01-01')", cast: "date"},
+	SortFirstNameEN: {expr: "COALESCE(p.first_name_en, '')", cast: "text"},
+	SortLastNameEN:  {expr: "COALESCE(p.last_name_en, '')", cast: "text"},
+}
+
+// PostgreSQL error codes translated by the patient writes.
+const (
+	pgUniqueViolation = "23505"
+	pgCheckViolation  = "23514"
+)
+
+// patientUniqueFields maps the unique indexes on persons and patients to
+// patient fields.
+var patientUniqueFields = map[string]string{
+	"uq_persons_national_id":     "national_id",
+	"uq_persons_passport_id":     "passport_id",
+	"uq_patients_hospital_email": "email",
+}
+
+// patientSearchRow is a patient row of a search, followed by its sort value
+// and, for fuzzy searches, its name similarity.
+type patientSearchRow struct {
+	models.Patient
+	SortValue string   `db:"sort_value"`
+	Score     *float64 `db:"score"`
+}
+
+// PostgresPatientRepository stores patients in PostgreSQL.
+type PostgresPatientRepository struct {
+	db database.DB
+}
+
+func NewPostgresPatientRepository(db database.DB) *PostgresPatientRepository {
+	return &PostgresPatientRepository{db: db}
+}
+
+// patientConditions returns the conditions selecting the patients matching
+// the filter, their arguments, and for a fuzzy name filter the expression of
+// the name similarity.
+func patientConditions(filter PatientFilter) ([]string, []interface{}, string) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	conditions = append(conditions, fmt.Sprintf("r.hospital_id = $%d", argIndex), "r.deleted_at IS NULL")
+	args = append(args, filter.HospitalID)
+	argIndex++
+
+	for _, exact := range []struct{ column, value string }{
+		{"r.patient_hn", filter.PatientHN},
+		{"p.national_id", filter.NationalID},
+		{"p.passport_id", filter.PassportID},
+	} {
+		if exact.value == "" {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", exact.column, argIndex))
+		args = append(args, exact.value)
+		argIndex++
+	}
+
+	// Name filters match either the English or the Thai column. Both modes
+	// are served by the trigram indexes on the name columns.
+	var scoreTerms []string
+	for _, name := range []struct{ value, en, th string }{
+		{filter.FirstName, "p.first_name_en", "p.first_name_th"},
+		{filter.MiddleName, "p.middle_name_en", "p.middle_name_th"},
+		{filter.LastName, "p.last_name_en", "p.last_name_th"},
+	} {
+		if name.value == "" {
+			continue
+		}
+
+		if filter.Fuzzy {
+			conditions = append(conditions, fmt.Sprintf("(%s %% $%d OR %s %% $%d)", name.en, argIndex, name.th, argIndex))
+			scoreTerms = append(scoreTerms, fmt.Sprintf("COALESCE(GREATEST(similarity(%s, $%d), similarity(%s, $%d)), 0)", name.en, argIndex, name.th, argIndex))
+			args = append(args, name.value)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s ILIKE $%d OR %s ILIKE $%d)", name.en, argIndex, name.th, argIndex))
+			args = append(args, "%"+name.value+"%")
+		}
+		argIndex++
+	}
+
+	if filter.Family != "" {
+		conditions = append(conditions, fmt.Sprintf("(p.last_name_en ILIKE $%d OR p.last_name_th ILIKE $%d)", argIndex, argIndex))
+		args = append(args, filter.Family+"%")
+		argIndex++
+	}
+	if filter.Given != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			"(p.first_name_en ILIKE $%d OR p.first_name_th ILIKE $%d OR p.middle_name_en ILIKE $%d OR p.middle_name_th ILIKE $%d)",
+			argIndex, argIndex, argIndex, argIndex,
+		))
+		args = append(args, filter.Given+"%")
+		argIndex++
+	}
+	if filter.DateOfBirth != "" {
+		conditions = append(conditions, fmt.Sprintf("p.date_of_birth = $%d", argIndex))
+		args = append(args, filter.DateOfBirth)
+	}
+
+	// The score is the mean similarity over the given name filters.
+	var score string
+	if len(scoreTerms) > 0 {
+		score = fmt.Sprintf("((%s) / %d)::float8", strings.Join(scoreTerms, " + "), len(scoreTerms))
+	}
+	return conditions, args, score
+}
+
+func (r *PostgresPatientRepository) Search(ctx context.Context, search PatientSearch) (*PatientPage, error) {
+	conditions, args, score := patientConditions(search.Filter)
+
+	sort, ok := patientSorts[search.Sort]
+	if search.Sort == SortScore && score != "" {
+		sort, ok = patientSort{expr: score, cast: "float8"}, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unable to sort patients by %q", search.Sort)
+	}
+
+	direction, comparison := "ASC", ">"
+	if search.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if search.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, r.id) %s ($%d::%s, $%d)", sort.expr, comparison, len(args)+1, sort.cast, len(args)+2))
+		args = append(args, search.After.Value, search.After.ID)
+	}
+
+	if score == "" {
+		score = "NULL::float8"
+	}
+
+	// One extra row tells whether there is a next page.
+	query := fmt.Sprintf(
+		`SELECT %s, (%s)::text AS sort_value, %s AS score FROM %s WHERE %s ORDER BY %s %s, r.id %s LIMIT $%d`,
+		patientColumns, sort.expr, score, patientTables,
+		strings.Join(conditions, " AND "),
+		sort.expr, direction, direction, len(args)+1,
+	)
+	args = append(args, search.Limit+1)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search patients: %w", err)
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[patientSearchRow])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read patients: %w", err)
+	}
+
+	page := &PatientPage{Patients: []*models.Patient{}}
+	if len(found) > search.Limit {
+		found = found[:search.Limit]
+		last := found[search.Limit-1]
+		page.Next = &PatientCursor{Value: last.SortValue, ID: last.ID}
+	}
+	for _, row := range found {
+		row.Patient.Score = row.Score
+		page.Patients = append(page.Patients, &row.Patient)
+	}
+	return page, nil
+}
+
+func (r *PostgresPatientRepository) List(ctx context.Context, filter PatientFilter, offset int, limit int) ([]*models.Patient, error) {
+	conditions, args, _ := patientConditions(filter)
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE %s ORDER BY r.created_at, r.id LIMIT $%d OFFSET $%d`,
+		patientColumns, patientTables, strings.Join(conditions, " AND "), len(args)+1, len(args)+2,
+	)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list patients: %w", err)
+	}
+	patients, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[models.Patient])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read patients: %w", err)
+	}
+	return patients, nil
+}
+
+func (r *PostgresPatientRepository) Count(ctx context.Context, filter PatientFilter) (int64, error) {
+	conditions, args, _ := patientConditions(filter)
+
+	var total int64
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, patientTables, strings.Join(conditions, " AND "))
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("unable to count patients: %w", err)
+	}
+	return total, nil
+}
+
+func (r *PostgresPatientRepository) GetByID(ctx context.Context, hospitalID string, id uuid.UUID) (*models.Patient, error) {
+	query := `SELECT ` + patientColumns + `
+		FROM ` + patientTables + `
+		WHERE r.id = $1 AND r.hospital_id = $2 AND r.deleted_at IS NULL
+	`
+	return queryPatient(ctx, r.db, query, id, hospitalID)
+}
+
+func (r *PostgresPatientRepository) GetByNationalID(ctx context.Context, hospitalID string, nationalID string) (*models.Patient, error) {
+	return r.getByIdentifier(ctx, "national_id", nationalID, hospitalID)
+}
+
+func (r *PostgresPatientRepository) GetByPassportID(ctx context.Context, hospitalID string, passportID string) (*models.Patient, error) {
+	return r.getByIdentifier(ctx, "passport_id", passportID, hospitalID)
+}
+
+// getByIdentifier prefers the registration at the given hospital and falls
+// back to any other.
+func (r *PostgresPatientRepository) getByIdentifier(ctx context.Context, column string, value string, hospitalID string) (*models.Patient, error) {
+	query := `SELECT ` + patientColumns + `
+		FROM ` + patientTables + `
+		WHERE p.` + column + ` = $1 AND r.deleted_at IS NULL
+		ORDER BY r.hospital_id = $2 DESC
+		LIMIT 1
+	`
+	return queryPatient(ctx, r.db, query, value, hospitalID)
+}
+
+func (r *PostgresPatientRepository) Create(ctx context.Context, hospitalID string, input *models.CreatePatientRequest) (*models.Patient, error) {
+	// A known person whose details differ from those given is not selected
+	// into person, so nothing is registered. patient_hn is left out so the
+	// database assigns the hospital's next number.
+	query := `
+		WITH matched AS (
+			SELECT ` + personColumns + ` FROM persons
+			WHERE national_id = $10 OR ($10::varchar IS NULL AND passport_id = $11)
+		), created AS (
+			INSERT INTO persons (` + personDetails + `)
+			SELECT $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			WHERE NOT EXISTS (SELECT 1 FROM matched)
+			RETURNING ` + personColumns + `
+		), person AS (
+			SELECT * FROM matched
+			WHERE (` + personDetails + `) IS NOT DISTINCT FROM (
+				$2::varchar, $3::varchar, $4::varchar, $5::varchar, $6::varchar, $7::varchar,
+				$8::date, $9::gender_enum, $10::varchar, $11::varchar
+			)
+			UNION ALL SELECT * FROM created
+		), registration AS (
+			INSERT INTO patients (person_id, hospital_id, phone_number, email)
+			SELECT id, $1::uuid, $12, $13 FROM person
+			RETURNING id, patient_hn, hospital_id, person_id, phone_number, email
+		)
+		SELECT ` + patientColumns + `
+		FROM registration r JOIN person p ON p.id = r.person_id
+	`
+
+	p, err := queryPatient(ctx, r.db, query,
+		hospitalID,
+		nullIfEmpty(input.FirstNameTH), nullIfEmpty(input.MiddleNameTH), nullIfEmpty(input.LastNameTH),
+		nullIfEmpty(input.FirstNameEN), nullIfEmpty(input.MiddleNameEN), nullIfEmpty(input.LastNameEN),
+		nullIfEmpty(input.DateOfBirth), nullIfEmpty(input.Gender),
+		nullIfEmpty(input.NationalID), nullIfEmpty(input.PassportID),
+		nullIfEmpty(input.PhoneNumber), nullIfEmpty(input.Email),
+	)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrPersonMismatch
+	}
+	if err != nil {
+		return nil, patientWriteError(err)
+	}
+	return p, nil
+}
+
+func (r *PostgresPatientRepository) Update(ctx context.Context, hospitalID string, id uuid.UUID, input *models.UpdatePatientRequest) (*models.Patient, error) {
+	type field struct {
+		column string
+		value  *string
+	}
+	personFields := []field{
+		{"first_name_th", input.FirstNameTH},
+		{"middle_name_th", input.MiddleNameTH},
+		{"last_name_th", input.LastNameTH},
+		{"first_name_en", input.FirstNameEN},
+		{"middle_name_en", input.MiddleNameEN},
+		{"last_name_en", input.LastNameEN},
+		{"date_of_birth", input.DateOfBirth},
+		{"gender", input.Gender},
+		{"national_id", input.NationalID},
+		{"passport_id", input.PassportID},
+	}
+	registrationFields := []field{
+		{"phone_number", input.PhoneNumber},
+		{"email", input.Email},
+	}
+
+	// set returns the assignments of the given fields, their arguments
+	// following args, and the changed columns.
+	set := func(fields []field, args []interface{}) ([]string, []string, []interface{}) {
+		var sets, columns []string
+		for _, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			args = append(args, nullIfEmpty(*field.value))
+			sets = append(sets, fmt.Sprintf("%s = $%d", field.column, len(args)))
+			columns = append(columns, field.column)
+		}
+		return sets, columns, args
+	}
+	personSets, personChanged, personArgs := set(personFields, []interface{}{})
+	registrationSets, _, registrationArgs := set(registrationFields, []interface{}{})
+	if len(personSets) == 0 && len(registrationSets) == 0 {
+		return nil, errors.New("no fields to update")
+	}
+
+	var p *models.Patient
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		// Lock the registration, and find whether another hospital has the
+		// person registered as well.
+		var personID uuid.UUID
+		var shared bool
+		err := tx.QueryRow(ctx, `
+			SELECT r.person_id, EXISTS (
+				SELECT 1 FROM patients o
+				WHERE o.person_id = r.person_id AND o.hospital_id <> r.hospital_id AND o.deleted_at IS NULL
+			)
+			FROM patients r
+			WHERE r.id = $1 AND r.hospital_id = $2 AND r.deleted_at IS NULL
+			FOR UPDATE
+		`, id, hospitalID).Scan(&personID, &shared)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(personSets) > 0 {
+			// Only a change to the values updates the person, so details
+			// sent again unchanged are accepted for a shared person.
+			query := fmt.Sprintf(
+				`UPDATE persons SET %s, updated_at = NOW()
+				 WHERE id = $%d AND (%s) IS DISTINCT FROM (%s)`,
+				strings.Join(personSets, ", "), len(personArgs)+1,
+				strings.Join(personChanged, ", "), personValues(personChanged, personArgs),
+			)
+			tag, err := tx.Exec(ctx, query, append(personArgs, personID)...)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() > 0 && shared {
+				return ErrSharedPerson
+			}
+		}
+
+		if len(registrationSets) > 0 {
+			query := fmt.Sprintf(
+				`UPDATE patients SET %s, updated_at = NOW() WHERE id = $%d`,
+				strings.Join(registrationSets, ", "), len(registrationArgs)+1,
+			)
+			if _, err := tx.Exec(ctx, query, append(registrationArgs, id)...); err != nil {
+				return err
+			}
+		}
+
+		p, err = queryPatient(ctx, tx, `SELECT `+patientColumns+` FROM `+patientTables+` WHERE r.id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return nil, patientWriteError(err)
+	}
+	return p, nil
+}
+
+// personValues returns the row of placeholders $1 to $n for the changed
+// person columns, cast to the column types so they compare with the row.
+func personValues(columns []string, args []interface{}) string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		cast := "varchar"
+		switch column {
+		case "date_of_birth":
+			cast = "date"
+		case "gender":
+			cast = "gender_enum"
+		}
+		values[i] = fmt.Sprintf("$%d::%s", i+1, cast)
+	}
+	return strings.Join(values, ", ")
+}
+
+func (r *PostgresPatientRepository) Delete(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	query := `
+		UPDATE patients SET deleted_at = NOW()
+		WHERE id = $1 AND hospital_id = $2 AND deleted_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, id, hospitalID)
+	if err != nil {
+		return fmt.Errorf("unable to delete patient: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// querier runs queries on the pool or in a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// queryPatient runs a query selecting patientColumns of at most one patient.
+func queryPatient(ctx context.Context, db querier, query string, args ...interface{}) (*models.Patient, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[models.Patient])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+// patientWriteError translates the constraint violations of a patient write.
+func patientWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		if pgErr.ConstraintName == "uq_patients_person_hospital" {
+			return ErrAlreadyRegistered
+		}
+		return &DuplicateError{Field: patientUniqueFields[pgErr.ConstraintName]}
+	case pgCheckViolation:
+		return ErrIdentifierRequired
+	}
+	return err
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,386 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"agnos_demo/internal/mocks"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testHospitalID = "6f1c1a52-0000-4000-8000-000000000001"
+
+// patientFields are the columns a patient query selects.
+var patientFields = []string{
+	"id", "patient_hn", "first_name_th", "middle_name_th", "last_name_th", "first_name_en", "middle_name_en", "last_name_en",
+	"date_of_birth", "gender", "national_id", "passport_id", "phone_number", "email", "hospital_id",
+}
+
+// patientRows returns rows of patients with the given IDs. Search rows carry
+// a sort value, "2024-01-01" for the first row and so on, and a score.
+func patientRows(search bool, ids ...uuid.UUID) *mocks.MockRows {
+	columns := patientFields
+	if search {
+		columns = append(slices.Clone(patientFields), "sort_value", "score")
+	}
+	fields := make([]pgconn.FieldDescription, len(columns))
+	for i, name := range columns {
+		fields[i].Name = name
+	}
+
+	rows := new(mocks.MockRows)
+	rows.On("FieldDescriptions").Return(fields)
+	if len(ids) > 0 {
+		rows.On("Next").Return(true).Times(len(ids))
+	}
+	rows.On("Next").Return(false)
+
+	row := 0
+	score := 0.5
+	targets := make([]interface{}, len(columns))
+	for i := range targets {
+		targets[i] = mock.Anything
+	}
+	rows.On("Scan", targets...).Run(func(args mock.Arguments) {
+		*args.Get(0).(*uuid.UUID) = ids[row]
+		if search {
+			*args.Get(15).(*string) = fmt.Sprintf("2024-01-0%d", row+1)
+			*args.Get(16).(**float64) = &score
+		}
+		row++
+	}).Return(nil)
+	rows.On("Err").Return(nil)
+	rows.On("Close").Return()
+	return rows
+}
+
+// failedRows returns rows that end with err before the first row.
+func failedRows(err error) *mocks.MockRows {
+	rows := new(mocks.MockRows)
+	rows.On("Next").Return(false)
+	rows.On("Err").Return(err)
+	rows.On("Close").Return()
+	return rows
+}
+
+func TestPatientSearch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Scoped To Hospital ID", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+
+		// The hospital is matched exactly, never as a patient_hn prefix
+		hospitalQuery := mock.MatchedBy(func(sql string) bool {
+			return strings.Contains(sql, "r.hospital_id = $1") && !strings.Contains(sql, "LIKE")
+		})
+		mockDB.On("Query", mock.Anything, hospitalQuery, []interface{}{testHospitalID, 21}).Return(patientRows(true), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		page, err := repo.Search(ctx, repository.PatientSearch{
+			Filter: repository.PatientFilter{HospitalID: testHospitalID},
+			Sort:   repository.SortCreatedAt,
+			Limit:  20,
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, page.Patients)
+		assert.Nil(t, page.Next)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Next Page Cursor", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+
+		// limit=2 fetches 3 rows; the third only signals that more exist
+		ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+		mockDB.On("Query", mock.Anything, mock.Anything, []interface{}{testHospitalID, 3}).Return(patientRows(true, ids...), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		page, err := repo.Search(ctx, repository.PatientSearch{
+			Filter:     repository.PatientFilter{HospitalID: testHospitalID},
+			Sort:       repository.SortCreatedAt,
+			Descending: true,
+			Limit:      2,
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Patients, 2)
+		assert.Equal(t, &repository.PatientCursor{Value: "2024-01-02", ID: ids[1]}, page.Next)
+	})
+
+	t.Run("After Cursor", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+
+		after := repository.PatientCursor{Value: "Doe", ID: uuid.New()}
+		keysetQuery := mock.MatchedBy(func(sql string) bool {
+			return strings.Contains(sql, "(COALESCE(p.last_name_en, ''), r.id) > ($2::text, $3)") &&
+				strings.Contains(sql, "ORDER BY COALESCE(p.last_name_en, '') ASC, r.id ASC")
+		})
+		mockDB.On("Query", mock.Anything, keysetQuery, []interface{}{testHospitalID, "Doe", after.ID, 11}).Return(patientRows(true), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		_, err := repo.Search(ctx, repository.PatientSearch{
+			Filter: repository.PatientFilter{HospitalID: testHospitalID},
+			Sort:   repository.SortLastNameEN,
+			After:  &after,
+			Limit:  10,
+		})
+
+		assert.NoError(t, err)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Fuzzy Name Match", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+
+		fuzzyQuery := mock.MatchedBy(func(sql string) bool {
+			return strings.Contains(sql, "p.first_name_en % $2") && strings.Contains(sql, "similarity(p.first_name_en, $2)")
+		})
+		mockDB.On("Query", mock.Anything, fuzzyQuery, mock.MatchedBy(func(args []interface{}) bool {
+			return len(args) == 3 && args[1] == "Jon"
+		})).Return(patientRows(true, uuid.New()), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		page, err := repo.Search(ctx, repository.PatientSearch{
+			Filter:     repository.PatientFilter{HospitalID: testHospitalID, FirstName: "Jon", Fuzzy: true},
+			Sort:       repository.SortScore,
+			Descending: true,
+			Limit:      20,
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Patients, 1)
+		assert.Equal(t, 0.5, *page.Patients[0].Score)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Score Sort Without Fuzzy", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		_, err := repo.Search(ctx, repository.PatientSearch{
+			Filter: repository.PatientFilter{HospitalID: testHospitalID, FirstName: "Jon"},
+			Sort:   repository.SortScore,
+			Limit:  20,
+		})
+
+		assert.Error(t, err)
+		mockDB.AssertNotCalled(t, "Query", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Rows Error", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(failedRows(errors.New("rows error")), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		_, err := repo.Search(ctx, repository.PatientSearch{
+			Filter: repository.PatientFilter{HospitalID: testHospitalID},
+			Sort:   repository.SortCreatedAt,
+			Limit:  20,
+		})
+
+		assert.ErrorContains(t, err, "rows error")
+	})
+}
+
+func TestPatientList(t *testing.T) {
+	mockDB := new(mocks.MockDB)
+
+	listQuery := mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "p.national_id = $2") &&
+			strings.Contains(sql, "p.last_name_en ILIKE $3") &&
+			strings.Contains(sql, "p.date_of_birth = $4")
+	})
+	mockDB.On("Query", mock.Anything, listQuery, []interface{}{testHospitalID, "1234567890121", "Do%", "1980-01-01", 1, 0}).
+		Return(patientRows(false, uuid.New()), nil)
+
+	repo := repository.NewPostgresPatientRepository(mockDB)
+	patients, err := repo.List(context.Background(), repository.PatientFilter{
+		HospitalID:  testHospitalID,
+		NationalID:  "1234567890121",
+		Family:      "Do",
+		DateOfBirth: "1980-01-01",
+	}, 0, 1)
+
+	assert.NoError(t, err)
+	assert.Len(t, patients, 1)
+	mockDB.AssertExpectations(t)
+}
+
+func TestPatientGetByNationalID(t *testing.T) {
+	t.Run("Prefers The Hospital", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		testID := uuid.New()
+		preferQuery := mock.MatchedBy(func(sql string) bool {
+			return strings.Contains(sql, "p.national_id = $1") && strings.Contains(sql, "ORDER BY r.hospital_id = $2 DESC")
+		})
+		mockDB.On("Query", mock.Anything, preferQuery, []interface{}{"1234567890121", testHospitalID}).Return(patientRows(false, testID), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		p, err := repo.GetByNationalID(context.Background(), testHospitalID, "1234567890121")
+
+		assert.NoError(t, err)
+		assert.Equal(t, testID, p.ID)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(patientRows(false), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		_, err := repo.GetByNationalID(context.Background(), testHospitalID, "1234567890121")
+
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestPatientCreateErrors(t *testing.T) {
+	var duplicate *repository.DuplicateError
+
+	tests := []struct {
+		name  string
+		err   error
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "Duplicate National ID",
+			err:  &pgconn.PgError{Code: "23505", ConstraintName: "uq_persons_national_id"},
+			check: func(t *testing.T, err error) {
+				assert.ErrorAs(t, err, &duplicate)
+				assert.Equal(t, "national_id", duplicate.Field)
+			},
+		},
+		{
+			name: "Already Registered At Hospital",
+			err:  &pgconn.PgError{Code: "23505", ConstraintName: "uq_patients_person_hospital"},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, repository.ErrAlreadyRegistered)
+			},
+		},
+		{
+			name: "Email Taken At Hospital",
+			err:  &pgconn.PgError{Code: "23505", ConstraintName: "uq_patients_hospital_email"},
+			check: func(t *testing.T, err error) {
+				assert.ErrorAs(t, err, &duplicate)
+				assert.Equal(t, "email", duplicate.Field)
+			},
+		},
+		{
+			// The person matched by identifier has other details, so nothing
+			// was inserted
+			name: "Person Mismatch",
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, repository.ErrPersonMismatch)
+			},
+		},
+		{
+			name: "Identifier Required",
+			err:  &pgconn.PgError{Code: "23514", ConstraintName: "chk_persons_identifier"},
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, repository.ErrIdentifierRequired)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(mocks.MockDB)
+			mockDB.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(failedRows(tt.err), nil)
+
+			repo := repository.NewPostgresPatientRepository(mockDB)
+			_, err := repo.Create(context.Background(), testHospitalID, &models.CreatePatientRequest{
+				FirstNameEN: "John",
+				LastNameEN:  "Doe",
+				NationalID:  "1234567890121",
+			})
+
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestPatientDelete(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		testID := uuid.New()
+		mockDB.On("Exec", mock.Anything, mock.Anything, []interface{}{testID, testHospitalID}).Return(pgconn.NewCommandTag("UPDATE 1"), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		assert.NoError(t, repo.Delete(context.Background(), testHospitalID, testID))
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mockDB := new(mocks.MockDB)
+		mockDB.On("Exec", mock.Anything, mock.Anything, mock.Anything).Return(pgconn.NewCommandTag("UPDATE 0"), nil)
+
+		repo := repository.NewPostgresPatientRepository(mockDB)
+		err := repo.Delete(context.Background(), testHospitalID, uuid.New())
+
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestPatientSharedPerson(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	var first, second string
+	require.NoError(t, pool.QueryRow(ctx, `
+		WITH inserted AS (
+			INSERT INTO hospitals (code, name) VALUES ('hn-001', 'Hospital 1'), ('hn-002', 'Hospital 2') RETURNING id, code
+		)
+		SELECT (SELECT id::text FROM inserted WHERE code = 'hn-001'), (SELECT id::text FROM inserted WHERE code = 'hn-002')
+	`).Scan(&first, &second))
+
+	repo := repository.NewPostgresPatientRepository(pool)
+	input := models.CreatePatientRequest{FirstNameEN: "Anna", LastNameEN: "Smith", NationalID: "1234567890121", PhoneNumber: "+66812345678"}
+	atFirst, err := repo.Create(ctx, first, &input)
+	require.NoError(t, err)
+
+	// Registering a known person needs their exact details, and echoes
+	// nothing the other hospital recorded
+	_, err = repo.Create(ctx, second, &models.CreatePatientRequest{FirstNameEN: "Ann", LastNameEN: "Smith", NationalID: "1234567890121"})
+	assert.ErrorIs(t, err, repository.ErrPersonMismatch)
+	input.PhoneNumber = ""
+	atSecond, err := repo.Create(ctx, second, &input)
+	require.NoError(t, err)
+	assert.Empty(t, atSecond.PhoneNumber)
+
+	// Contact details belong to the registration
+	phone := "+66899999999"
+	_, err = repo.Update(ctx, first, atFirst.ID, &models.UpdatePatientRequest{PhoneNumber: &phone})
+	require.NoError(t, err)
+	p, err := repo.GetByID(ctx, second, atSecond.ID)
+	require.NoError(t, err)
+	assert.Empty(t, p.PhoneNumber)
+
+	// The person's details are shared, so neither hospital changes them
+	name := "Anne"
+	_, err = repo.Update(ctx, first, atFirst.ID, &models.UpdatePatientRequest{FirstNameEN: &name})
+	assert.ErrorIs(t, err, repository.ErrSharedPerson)
+	p, err = repo.GetByID(ctx, second, atSecond.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.NullString("Anna"), p.FirstNameEN)
+	p, err = repo.GetByID(ctx, first, atFirst.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.NullString(phone), p.PhoneNumber)
+
+	// Unless the other registration is gone
+	require.NoError(t, repo.Delete(ctx, second, atSecond.ID))
+	p, err = repo.Update(ctx, first, atFirst.ID, &models.UpdatePatientRequest{FirstNameEN: &name})
+	require.NoError(t, err)
+	assert.Equal(t, models.NullString(name), p.FirstNameEN)
+}
@@ -0,0 +1,199 @@
+// Package repository provides the storage used by the HTTP handlers: patients,
+// staff and their sessions, and the audit trail.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist, or
+	// not within the given hospital.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyRegistered is returned when a person is registered twice at
+	// the same hospital.
+	ErrAlreadyRegistered = errors.New("patient is already registered at this hospital")
+	// ErrIdentifierRequired is returned when a patient would be left without
+	// both a national ID and a passport number.
+	ErrIdentifierRequired = errors.New("either national_id or passport_id is required")
+	// ErrPersonMismatch is returned when a patient is registered under the
+	// identifier of a known person but with other details than theirs.
+	ErrPersonMismatch = errors.New("patient details do not match the person registered with this identifier")
+	// ErrSharedPerson is returned when an update would change the details of
+	// a person that another hospital has registered as well.
+	ErrSharedPerson = errors.New("patient details are shared with another hospital")
+)
+
+// DuplicateError is returned when a patient detail that must be unique, such
+// as the national ID, belongs to another person.
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("patient with this %s already exists", e.Field)
+}
+
+// Sort keys accepted by PatientRepository.Search.
+const (
+	SortCreatedAt   = "created_at"
+	SortDateOfBirth = "date_of_birth"
+	SortFirstNameEN = "first_name_en"
+	SortLastNameEN  = "last_name_en"
+	// SortScore orders by name similarity and requires a fuzzy filter.
+	SortScore = "score"
+)
+
+// PatientFilter selects the live patients of a hospital. Empty fields do not
+// filter.
+type PatientFilter struct {
+	HospitalID  string
+	PatientHN   string
+	NationalID  string
+	PassportID  string
+	DateOfBirth string // YYYY-MM-DD
+
+	// FirstName, MiddleName and LastName match either the English or the
+	// Thai name, as a substring or, when Fuzzy is set, by similarity.
+	FirstName  string
+	MiddleName string
+	LastName   string
+	Fuzzy      bool
+
+	// Family matches the start of the last name and Given the start of the
+	// first or middle name, in either language.
+	Family string
+	Given  string
+}
+
+// PatientCursor is the position of a patient in a sorted search.
+type PatientCursor struct {
+	Value string // The patient's sort key, as text
+	ID    uuid.UUID
+}
+
+// PatientPage is a page of a patient search. Next is nil on the last page.
+type PatientPage struct {
+	Patients []*models.Patient
+	Next     *PatientCursor
+}
+
+// PatientSearch is a keyset-paginated patient search.
+type PatientSearch struct {
+	Filter     PatientFilter
+	Sort       string
+	Descending bool
+	After      *PatientCursor
+	Limit      int
+}
+
+type PatientRepository interface {
+	// Search returns a page of the patients matching the filter.
+	Search(ctx context.Context, search PatientSearch) (*PatientPage, error)
+	// List returns the patients matching the filter in registration order,
+	// skipping the first offset.
+	List(ctx context.Context, filter PatientFilter, offset int, limit int) ([]*models.Patient, error)
+	// Count returns the number of patients matching the filter.
+	Count(ctx context.Context, filter PatientFilter) (int64, error)
+	// GetByID returns a registration at the hospital.
+	GetByID(ctx context.Context, hospitalID string, id uuid.UUID) (*models.Patient, error)
+	// GetByNationalID and GetByPassportID return the registration of the
+	// person at the hospital, or else their registration at any other
+	// hospital, so that the caller can tell it apart from an unknown person.
+	GetByNationalID(ctx context.Context, hospitalID string, nationalID string) (*models.Patient, error)
+	GetByPassportID(ctx context.Context, hospitalID string, passportID string) (*models.Patient, error)
+	// Create registers a patient at the hospital, linking the registration
+	// to the person already known under the national ID (or, without one,
+	// the passport) and creating the person otherwise. A known person is only
+	// registered if the names, date of birth, gender and identifiers given
+	// are exactly theirs. The phone number and email are the registration's.
+	Create(ctx context.Context, hospitalID string, input *models.CreatePatientRequest) (*models.Patient, error)
+	// Update changes patient id at the hospital. The phone number and email
+	// are changed on the registration only. The other details belong to the
+	// person and cannot be changed while another hospital has the person
+	// registered too.
+	Update(ctx context.Context, hospitalID string, id uuid.UUID, input *models.UpdatePatientRequest) (*models.Patient, error)
+	// Delete soft-deletes a registration at the hospital.
+	Delete(ctx context.Context, hospitalID string, id uuid.UUID) error
+}
+
+// RefreshSession is the staff member and session a rotated refresh token
+// belonged to.
+type RefreshSession struct {
+	StaffID  uuid.UUID
+	FamilyID uuid.UUID
+	Hospital models.Hospital
+}
+
+type StaffRepository interface {
+	// GetActive returns the active staff member with the username at the
+	// hospital with the given code, including their password hash.
+	GetActive(ctx context.Context, username string, hospitalCode string) (*models.Staff, error)
+	// Create adds a staff member to the hospital with the given roles.
+	Create(ctx context.Context, hospitalID string, username string, passwordHash string, roles []string) (uuid.UUID, error)
+	// Deactivate deactivates an active staff member of the hospital and
+	// revokes their refresh tokens.
+	Deactivate(ctx context.Context, hospitalID string, id uuid.UUID) error
+	// Access returns the role names of a staff member and the union of their
+	// permissions.
+	Access(ctx context.Context, staffID uuid.UUID) (roles []string, permissions []string, err error)
+
+	// StoreRefreshToken stores a refresh token in a session family.
+	StoreRefreshToken(ctx context.Context, staffID uuid.UUID, familyID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	// RotateRefreshToken revokes a live refresh token of an active staff
+	// member and returns its session, so it can only ever be exchanged once.
+	RotateRefreshToken(ctx context.Context, tokenHash string) (*RefreshSession, error)
+	// RevokeReusedRefreshToken revokes the session of an already revoked
+	// refresh token and returns the number of tokens it revoked.
+	RevokeReusedRefreshToken(ctx context.Context, tokenHash string) (int64, error)
+	// RevokeSession revokes the session of a refresh token of the staff member.
+	RevokeSession(ctx context.Context, staffID string, tokenHash string) error
+	// RevokeAccessToken revokes an access token until it expires.
+	RevokeAccessToken(ctx context.Context, jti string, staffID string, expiresAt time.Time) error
+	// IsAccessRevoked reports whether an access token may no longer be used:
+	// it was revoked, or the staff member it was issued to is not active.
+	IsAccessRevoked(ctx context.Context, jti string, staffID string) (bool, error)
+}
+
+// AuditRecord is an event to append to the audit trail. Empty strings are
+// stored as NULL.
+type AuditRecord struct {
+	StaffID       string
+	HospitalID    string
+	Action        string
+	PatientIDs    []uuid.UUID
+	TargetStaffID *uuid.UUID
+	Filters       map[string]string
+	RequestID     string
+	IPAddress     string
+}
+
+// AuditFilter selects the events of a hospital. Nil and zero fields do not
+// filter.
+type AuditFilter struct {
+	HospitalID string
+	StaffID    *uuid.UUID
+	PatientID  *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+	BeforeSeq  int64
+}
+
+type AuditRepository interface {
+	// Record appends an event to the audit trail. The database assigns its
+	// sequence number, timestamp and chain hash.
+	Record(ctx context.Context, record AuditRecord) error
+	// List returns up to limit events matching the filter, newest first, and
+	// whether older ones exist.
+	List(ctx context.Context, filter AuditFilter, limit int) ([]*models.AuditEvent, bool, error)
+	// Verify recomputes the hash chain over the whole audit trail, and
+	// reports on the events of the hospital only.
+	Verify(ctx context.Context, hospitalID string) (*models.AuditVerifyResponse, error)
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"agnos_demo/internal/database"
+	"agnos_demo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresStaffRepository stores staff, their roles and their sessions in
+// PostgreSQL.
+type PostgresStaffRepository struct {
+	db database.DB
+}
+
+func NewPostgresStaffRepository(db database.DB) *PostgresStaffRepository {
+	return &PostgresStaffRepository{db: db}
+}
+
+func (r *PostgresStaffRepository) GetActive(ctx context.Context, username string, hospitalCode string) (*models.Staff, error) {
+	query := `
+		SELECT s.id, s.username, s.password_hash, h.id, h.code
+		FROM staff s
+		JOIN hospitals h ON h.id = s.hospital_id
+		WHERE s.username = $1 AND h.code = $2 AND s.is_active
+	`
+
+	staff := models.Staff{IsActive: true}
+	err := r.db.QueryRow(ctx, query, username, hospitalCode).Scan(
+		&staff.ID,
+		&staff.Username,
+		&staff.PasswordHash,
+		&staff.HospitalID,
+		&staff.Hospital,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("unable to load staff: %w", err)
+	}
+	return &staff, nil
+}
+
+func (r *PostgresStaffRepository) Create(ctx context.Context, hospitalID string, username string, passwordHash string, roles []string) (uuid.UUID, error) {
+	query := `
+		WITH new_staff AS (
+			INSERT INTO staff (username, password_hash, hospital_id)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		), assigned AS (
+			INSERT INTO staff_roles (staff_id, role_id)
+			SELECT new_staff.id, roles.id FROM new_staff, roles
+			WHERE roles.name = ANY($4)
+		)
+		SELECT id FROM new_staff
+	`
+
+	var staffID uuid.UUID
+	if err := r.db.QueryRow(ctx, query, username, passwordHash, hospitalID, roles).Scan(&staffID); err != nil {
+		return uuid.Nil, fmt.Errorf("unable to create staff: %w", err)
+	}
+	return staffID, nil
+}
+
+func (r *PostgresStaffRepository) Deactivate(ctx context.Context, hospitalID string, id uuid.UUID) error {
+	// Existing access tokens are rejected by AuthMiddleware once is_active is
+	// false; outstanding refresh tokens are revoked here as well.
+	query := `
+		WITH deactivated AS (
+			UPDATE staff SET is_active = FALSE, deactivated_at = NOW()
+			WHERE id = $1 AND hospital_id = $2 AND is_active
+			RETURNING id
+		), revoked AS (
+			UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE staff_id IN (SELECT id FROM deactivated) AND revoked_at IS NULL
+		)
+		SELECT id FROM deactivated
+	`
+
+	var deactivatedID uuid.UUID
+	if err := r.db.QueryRow(ctx, query, id, hospitalID).Scan(&deactivatedID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("unable to deactivate staff: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresStaffRepository) Access(ctx context.Context, staffID uuid.UUID) ([]string, []string, error) {
+	query := `
+		SELECT
+			COALESCE(array_agg(DISTINCT r.name) FILTER (WHERE r.name IS NOT NULL), '{}'),
+			COALESCE(array_agg(DISTINCT p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM staff_roles sr
+		JOIN roles r ON r.id = sr.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE sr.staff_id = $1
+	`
+
+	var roles, permissions []string
+	if err := r.db.QueryRow(ctx, query, staffID).Scan(&roles, &permissions); err != nil {
+		return nil, nil, fmt.Errorf("unable to load staff roles: %w", err)
+	}
+	return roles, permissions, nil
+}
+
+func (r *PostgresStaffRepository) StoreRefreshToken(ctx context.Context, staffID uuid.UUID, familyID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	// Expired tokens can no longer be rotated, so they are pruned here rather
+	// than left to grow the table.
+	query := `
+		WITH pruned AS (
+			DELETE FROM refresh_tokens WHERE expires_at <= NOW()
+		)
+		INSERT INTO refresh_tokens (staff_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := r.db.Exec(ctx, query, staffID, familyID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("unable to store refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresStaffRepository) RotateRefreshToken(ctx context.Context, tokenHash string) (*RefreshSession, error) {
+	// The token is revoked in the same statement that validates it.
+	query := `
+		UPDATE refresh_tokens rt SET revoked_at = NOW()
+		FROM staff s
+		JOIN hospitals h ON h.id = s.hospital_id
+		WHERE rt.token_hash = $1 AND rt.revoked_at IS NULL AND rt.expires_at > NOW()
+		  AND s.id = rt.staff_id AND s.is_active
+		RETURNING rt.staff_id, rt.family_id, h.id, h.code
+	`
+
+	var session RefreshSession
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&session.StaffID, &session.FamilyID, &session.Hospital.ID, &session.Hospital.Code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("unable to rotate refresh token: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *PostgresStaffRepository) RevokeReusedRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND revoked_at IS NOT NULL)
+		  AND revoked_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, tokenHash)
+	if err != nil {
+		return 0, fmt.Errorf("unable to revoke refresh token family: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PostgresStaffRepository) RevokeSession(ctx context.Context, staffID string, tokenHash string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND staff_id = $2)
+		  AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.Exec(ctx, query, tokenHash, staffID); err != nil {
+		return fmt.Errorf("unable to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresStaffRepository) RevokeAccessToken(ctx context.Context, jti string, staffID string, expiresAt time.Time) error {
+	// An expired access token is refused whether revoked or not, so its
+	// entry is pruned here rather than left to grow the table.
+	query := `
+		WITH pruned AS (
+			DELETE FROM revoked_tokens WHERE expires_at <= NOW()
+		)
+		INSERT INTO revoked_tokens (jti, staff_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	if _, err := r.db.Exec(ctx, query, jti, staffID, expiresAt); err != nil {
+		return fmt.Errorf("unable to revoke access token: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresStaffRepository) IsAccessRevoked(ctx context.Context, jti string, staffID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR NOT EXISTS (SELECT 1 FROM staff WHERE id = $2 AND is_active)
+	`
+
+	var revoked bool
+	if err := r.db.QueryRow(ctx, query, jti, staffID).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("unable to check access token revocation: %w", err)
+	}
+	return revoked, nil
+}
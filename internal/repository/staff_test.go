@@ -0,0 +1,122 @@
+package repository_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"agnos_demo/internal/mocks"
+	"agnos_demo/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaffNotFound(t *testing.T) {
+	ctx := context.Background()
+
+	// noRows returns a database whose single-row queries of n columns find
+	// nothing.
+	noRows := func(n int) *mocks.MockDB {
+		targets := make([]interface{}, n)
+		for i := range targets {
+			targets[i] = mock.Anything
+		}
+		mockRow := new(mocks.MockRow)
+		mockRow.On("Scan", targets...).Return(pgx.ErrNoRows)
+		mockDB := new(mocks.MockDB)
+		mockDB.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).Return(mockRow)
+		return mockDB
+	}
+
+	t.Run("GetActive", func(t *testing.T) {
+		repo := repository.NewPostgresStaffRepository(noRows(5))
+		_, err := repo.GetActive(ctx, "nobody", "hn-001")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Deactivate", func(t *testing.T) {
+		repo := repository.NewPostgresStaffRepository(noRows(1))
+		err := repo.Deactivate(ctx, testHospitalID, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("RotateRefreshToken", func(t *testing.T) {
+		repo := repository.NewPostgresStaffRepository(noRows(4))
+		_, err := repo.RotateRefreshToken(ctx, "revoked-token-hash")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestStaffIsAccessRevoked(t *testing.T) {
+	staffID := uuid.New().String()
+	mockRow := new(mocks.MockRow)
+	mockRow.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*bool) = true
+	}).Return(nil)
+	mockDB := new(mocks.MockDB)
+	mockDB.On("QueryRow", mock.Anything, mock.MatchedBy(func(sql string) bool {
+		return strings.Contains(sql, "revoked_tokens") && strings.Contains(sql, "is_active")
+	}), []interface{}{"token-jti", staffID}).Return(mockRow)
+
+	repo := repository.NewPostgresStaffRepository(mockDB)
+	revoked, err := repo.IsAccessRevoked(context.Background(), "token-jti", staffID)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	mockDB.AssertExpectations(t)
+}
+
+func TestStaffPrunesExpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	expired, live := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+
+	t.Run("On Write", func(t *testing.T) {
+		// prunes matches a statement that deletes the expired rows of table
+		// before inserting into it.
+		prunes := func(table string) interface{} {
+			return mock.MatchedBy(func(sql string) bool {
+				return strings.Contains(sql, "DELETE FROM "+table+" WHERE expires_at <= NOW()") &&
+					strings.Contains(sql, "INSERT INTO "+table)
+			})
+		}
+		mockDB := new(mocks.MockDB)
+		mockDB.On("Exec", mock.Anything, prunes("refresh_tokens"), mock.Anything).Return(pgconn.NewCommandTag("INSERT 0 1"), nil)
+		mockDB.On("Exec", mock.Anything, prunes("revoked_tokens"), mock.Anything).Return(pgconn.NewCommandTag("INSERT 0 1"), nil)
+
+		repo := repository.NewPostgresStaffRepository(mockDB)
+		staffID := uuid.New()
+		require.NoError(t, repo.StoreRefreshToken(ctx, staffID, uuid.New(), "token-hash", live))
+		require.NoError(t, repo.RevokeAccessToken(ctx, "token-jti", staffID.String(), live))
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("Database", func(t *testing.T) {
+		pool := testPool(t)
+		var staffID uuid.UUID
+		require.NoError(t, pool.QueryRow(ctx, `
+			WITH hospital AS (
+				INSERT INTO hospitals (code, name) VALUES ('hn-001', 'Hospital 1') RETURNING id
+			)
+			INSERT INTO staff (username, password_hash, hospital_id) SELECT 'somchai', 'hash', id FROM hospital
+			RETURNING id
+		`).Scan(&staffID))
+
+		repo := repository.NewPostgresStaffRepository(pool)
+		require.NoError(t, repo.StoreRefreshToken(ctx, staffID, uuid.New(), "expired", expired))
+		require.NoError(t, repo.StoreRefreshToken(ctx, staffID, uuid.New(), "live", live))
+		require.NoError(t, repo.RevokeAccessToken(ctx, uuid.NewString(), staffID.String(), expired))
+		require.NoError(t, repo.RevokeAccessToken(ctx, uuid.NewString(), staffID.String(), live))
+
+		var refresh, revoked int
+		require.NoError(t, pool.QueryRow(ctx, `
+			SELECT (SELECT count(*) FROM refresh_tokens), (SELECT count(*) FROM revoked_tokens)
+		`).Scan(&refresh, &revoked))
+		assert.Equal(t, 1, refresh)
+		assert.Equal(t, 1, revoked)
+	})
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"net/http"
+
+	"agnos_demo/internal/metrics"
+)
+
+// NewAdminRouter returns the handler of the admin port, which serves
+// operational endpoints that are kept off the public API.
+func NewAdminRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
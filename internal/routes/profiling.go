@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// RuntimeStats is the summary of the Go runtime served at /debug/runtime.
+type RuntimeStats struct {
+	Goroutines int `json:"goroutines"`
+	Heap       struct {
+		AllocBytes      uint64 `json:"alloc_bytes"`
+		InuseBytes      uint64 `json:"inuse_bytes"`
+		IdleBytes       uint64 `json:"idle_bytes"`
+		SysBytes        uint64 `json:"sys_bytes"`
+		Objects         uint64 `json:"objects"`
+		NextGCBytes     uint64 `json:"next_gc_bytes"`
+		TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	} `json:"heap"`
+	GC struct {
+		Count       uint32        `json:"count"`
+		PauseTotal  time.Duration `json:"pause_total_ns"`
+		LastPause   time.Duration `json:"last_pause_ns"`
+		LastRun     *time.Time    `json:"last_run,omitempty"`
+		CPUFraction float64       `json:"cpu_fraction"`
+	} `json:"gc"`
+}
+
+// NewProfilingRouter returns the handler of the profiling listener: the
+// net/http/pprof endpoints under /debug/pprof/ and runtime stats at
+// /debug/runtime. Every request must carry the admin token as a bearer
+// token; with an empty token every request is refused.
+func NewProfilingRouter(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/runtime", serveRuntimeStats)
+	return requireAdminToken(token, mux)
+}
+
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serveRuntimeStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var stats RuntimeStats
+	stats.Goroutines = runtime.NumGoroutine()
+	stats.Heap.AllocBytes = mem.HeapAlloc
+	stats.Heap.InuseBytes = mem.HeapInuse
+	stats.Heap.IdleBytes = mem.HeapIdle
+	stats.Heap.SysBytes = mem.HeapSys
+	stats.Heap.Objects = mem.HeapObjects
+	stats.Heap.NextGCBytes = mem.NextGC
+	stats.Heap.TotalAllocBytes = mem.TotalAlloc
+	stats.GC.Count = mem.NumGC
+	stats.GC.PauseTotal = time.Duration(mem.PauseTotalNs)
+	stats.GC.CPUFraction = mem.GCCPUFraction
+	if mem.NumGC > 0 {
+		stats.GC.LastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+		lastRun := time.Unix(0, int64(mem.LastGC))
+		stats.GC.LastRun = &lastRun
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
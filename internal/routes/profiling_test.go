@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilingRouter(t *testing.T) {
+	serve := func(h http.Handler, path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	h := NewProfilingRouter("s3cret")
+
+	t.Run("Requires Token", func(t *testing.T) {
+		for _, authorization := range []string{"", "Bearer wrong", "s3cret", "Basic s3cret"} {
+			w := serve(h, "/debug/pprof/", authorization)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+		}
+	})
+
+	t.Run("Empty Token Refuses All", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(NewProfilingRouter(""), "/debug/pprof/", "Bearer ").Code)
+	})
+
+	t.Run("Profiles", func(t *testing.T) {
+		w := serve(h, "/debug/pprof/", "Bearer s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "goroutine")
+
+		w = serve(h, "/debug/pprof/heap?debug=1", "Bearer s3cret")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Runtime Stats", func(t *testing.T) {
+		w := serve(h, "/debug/runtime", "Bearer s3cret")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var stats RuntimeStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.Positive(t, stats.Goroutines)
+		assert.Positive(t, stats.Heap.SysBytes)
+	})
+}
+
+func TestInitConfigRequiresProfilingToken(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("API.FHIRBaseURL", "https://api.example.com/fhir")
+	viper.Set("API.EnableProfiling", true)
+
+	_, err := InitConfig()
+	assert.ErrorContains(t, err, "API.ProfilingToken")
+
+	viper.Set("API.ProfilingToken", "s3cret")
+	config, err := InitConfig()
+	require.NoError(t, err)
+	assert.True(t, config.EnableProfiling)
+}
+
+func TestInitConfigTrustedProxies(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("API.FHIRBaseURL", "https://api.example.com/fhir")
+
+	config, err := InitConfig()
+	require.NoError(t, err)
+	assert.Empty(t, config.TrustedProxies)
+
+	viper.Set("API.TrustedProxies", []string{"10.0.0.1", "172.16.0.0/12"})
+	config, err = InitConfig()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "172.16.0.0/12"}, config.TrustedProxies)
+
+	viper.Set("API.TrustedProxies", []string{"nginx"})
+	_, err = InitConfig()
+	assert.ErrorContains(t, err, `"nginx" is not an IP address`)
+}
+
+func TestInitConfigFHIRBaseURL(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	for _, base := range []string{"", "/fhir", "api.example.com/fhir"} {
+		viper.Set("API.FHIRBaseURL", base)
+		_, err := InitConfig()
+		assert.ErrorContains(t, err, "API.FHIRBaseURL", base)
+	}
+
+	viper.Set("API.FHIRBaseURL", "https://api.example.com/fhir")
+	config, err := InitConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/fhir", config.FHIRBaseURL)
+}
@@ -1,55 +1,130 @@
 package routes
 
 import (
-	"log/slog"
-	"os"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
 
 	"agnos_demo/internal/handlers"
 	"agnos_demo/internal/middleware"
 	"agnos_demo/internal/service"
+	"agnos_demo/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port int
+	Port         int
+	AdminHost    string // the address the admin server listens on
+	AdminPort    int
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	ServiceName  string
+
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For header gives the client IP. Requests from anywhere
+	// else are attributed to their remote address.
+	TrustedProxies []string
+
+	// FHIRBaseURL is the absolute URL the FHIR endpoints are published at,
+	// such as https://api.example.com/fhir.
+	FHIRBaseURL string
+
+	EnableProfiling bool
+	ProfilingPort   int
+	ProfilingToken  string
 }
 
 func InitConfig() (*Config, error) {
-	return &Config{
-		Port: viper.GetInt("API.HTTPServerPort"),
-	}, nil
+	config := &Config{
+		Port:         viper.GetInt("API.HTTPServerPort"),
+		AdminHost:    viper.GetString("API.AdminHost"),
+		AdminPort:    viper.GetInt("API.AdminPort"),
+		ReadTimeout:  viper.GetDuration("API.ReadTimeout"),
+		WriteTimeout: viper.GetDuration("API.WriteTimeout"),
+		ServiceName:  viper.GetString("Tracing.ServiceName"),
+
+		TrustedProxies: viper.GetStringSlice("API.TrustedProxies"),
+		FHIRBaseURL:    viper.GetString("API.FHIRBaseURL"),
+
+		EnableProfiling: viper.GetBool("API.EnableProfiling"),
+		ProfilingPort:   viper.GetInt("API.ProfilingPort"),
+		ProfilingToken:  viper.GetString("API.ProfilingToken"),
+	}
+
+	if config.EnableProfiling && config.ProfilingToken == "" {
+		return nil, errors.New("API.EnableProfiling requires API.ProfilingToken to be set")
+	}
+	for _, proxy := range config.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("API.TrustedProxies: %q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+	if base, err := url.Parse(config.FHIRBaseURL); err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("API.FHIRBaseURL %q must be an absolute URL", config.FHIRBaseURL)
+	}
+	return config, nil
 }
 
-func NewRouter(service *service.Service) *gin.Engine {
+func NewRouter(service *service.Service, config *Config) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	// Client IPs end up in logs and the audit trail, so forwarding headers
+	// are only believed from the configured proxies. InitConfig has checked
+	// their addresses.
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		panic(err)
+	}
 	r.Use(gin.Recovery())
-	r.Use(middleware.SlogMiddleware())
-
-	// Create logger for handlers
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}))
+	// The request span is started first so that the logs, metrics and
+	// queries of the request all belong to it.
+	r.Use(tracing.Middleware(config.ServiceName)...)
+	r.Use(middleware.SlogMiddleware(service.Logger))
+	r.Use(middleware.MetricsMiddleware())
+	// Once the write timeout has passed the response can no longer be sent,
+	// so whatever the request is still doing is cancelled.
+	r.Use(middleware.RequestTimeout(config.WriteTimeout))
 
-	h := handlers.NewHandlers(service.DB, logger)
+	h := handlers.NewHandlers(service.Patients, service.Staff, service.Audit, service.Logger, config.FHIRBaseURL)
 
 	// Public routes
 	r.GET("/health", h.HealthCheck)
 	r.POST("/staff/login", h.LoginStaff)
+	r.POST("/staff/token/refresh", h.RefreshToken)
 
 	// Protected routes
 	staffProtectedRoute := r.Group("/staff")
-	staffProtectedRoute.Use(middleware.AuthMiddleware())
+	staffProtectedRoute.Use(middleware.AuthMiddleware(service.Staff))
 	{
-		staffProtectedRoute.POST("/create", h.CreateStaff)
+		staffProtectedRoute.POST("/create", middleware.RequirePermission(middleware.PermissionStaffCreate), h.CreateStaff)
+		staffProtectedRoute.POST("/logout", h.Logout)
+		staffProtectedRoute.POST("/:id/deactivate", middleware.RequirePermission(middleware.PermissionStaffDeactivate), h.DeactivateStaff)
 	}
 	patientProtectedRoute := r.Group("/patient")
-	patientProtectedRoute.Use(middleware.AuthMiddleware())
+	patientProtectedRoute.Use(middleware.AuthMiddleware(service.Staff))
+	{
+		patientProtectedRoute.GET("/search", middleware.RequirePermission(middleware.PermissionPatientRead), h.SearchPatient)
+		patientProtectedRoute.GET("/search/:id", middleware.RequirePermission(middleware.PermissionPatientRead), h.GetPatientByID)
+		patientProtectedRoute.POST("", middleware.RequirePermission(middleware.PermissionPatientWrite), h.CreatePatient)
+		patientProtectedRoute.PATCH("/:id", middleware.RequirePermission(middleware.PermissionPatientWrite), h.UpdatePatient)
+		patientProtectedRoute.DELETE("/:id", middleware.RequirePermission(middleware.PermissionPatientWrite), h.DeletePatient)
+	}
+	auditProtectedRoute := r.Group("/audit")
+	auditProtectedRoute.Use(middleware.AuthMiddleware(service.Staff), middleware.RequirePermission(middleware.PermissionAuditRead))
+	{
+		auditProtectedRoute.GET("", h.ListAuditEvents)
+		auditProtectedRoute.GET("/verify", h.VerifyAuditTrail)
+	}
+	fhirProtectedRoute := r.Group("/fhir")
+	fhirProtectedRoute.Use(middleware.AuthMiddleware(service.Staff), middleware.RequirePermission(middleware.PermissionPatientRead))
 	{
-		patientProtectedRoute.GET("/search", h.SearchPatient)
-		patientProtectedRoute.GET("/search/:id", h.GetPatientByID)
+		fhirProtectedRoute.GET("/Patient", h.SearchFHIRPatients)
+		fhirProtectedRoute.GET("/Patient/:id", h.GetFHIRPatient)
 	}
 
 	return r
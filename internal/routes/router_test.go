@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agnos_demo/internal/logging"
+	"agnos_demo/internal/middleware"
+	"agnos_demo/internal/models"
+	"agnos_demo/internal/repository"
+	"agnos_demo/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRouterLogsNoPII(t *testing.T) {
+	// Personal data sent in the requests below, none of which may be logged.
+	pii := []string{
+		"somchai.j", "Somchai", "Jaidee", "1234567890121", "AB1234567",
+		"1990-05-17", "081-234-5678", "+66812345678", "somchai@example.com",
+	}
+
+	for _, mode := range []string{logging.RedactMask, logging.RedactHash} {
+		t.Run(mode, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := logging.New(&buf, &logging.Config{Level: "debug", JSON: true, Redaction: mode})
+			require.NoError(t, err)
+
+			hospital := models.Hospital{ID: uuid.New(), Code: "hn-001"}
+			staff := repository.NewMemoryStaffRepository(hospital)
+			hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+			require.NoError(t, err)
+			_, err = staff.Create(context.Background(), hospital.ID.String(), "somchai.j", string(hash), []string{middleware.RoleClerk})
+			require.NoError(t, err)
+
+			router := NewRouter(&service.Service{
+				Logger:   logger,
+				Patients: repository.NewMemoryPatientRepository(0.25),
+				Staff:    staff,
+				Audit:    repository.NewMemoryAuditRepository(),
+			}, &Config{ServiceName: "test"})
+
+			do := func(method, path, token, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+				req.Header.Set("Content-Type", "application/json")
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			w := do("POST", "/staff/login", "", `{"username": "somchai.j", "password": "password123", "hospital": "hn-001"}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var tokens models.TokenResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+			assert.Equal(t, http.StatusUnauthorized, do("POST", "/staff/login", "", `{"username": "somchai.j", "password": "wrong", "hospital": "hn-001"}`).Code)
+
+			w = do("POST", "/patient", tokens.Token, `{"first_name_en": "Somchai", "last_name_en": "Jaidee", "national_id": "1234567890121",
+				"date_of_birth": "1990-05-17", "phone_number": "081-234-5678", "email": "somchai@example.com"}`)
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			assert.Equal(t, http.StatusOK, do("GET", "/patient/search?first_name=Somchai&last_name=Jaidee&date_of_birth=1990-05-17", tokens.Token, "").Code)
+			assert.Equal(t, http.StatusOK, do("GET", "/patient/search?national_id=1234567890121", tokens.Token, "").Code)
+			assert.Equal(t, http.StatusOK, do("GET", "/patient/search/1234567890121", tokens.Token, "").Code)
+			assert.Equal(t, http.StatusNotFound, do("GET", "/patient/search/AB1234567", tokens.Token, "").Code)
+			assert.Equal(t, http.StatusOK, do("GET", "/fhir/Patient?family=Jaidee&birthdate=1990-05-17", tokens.Token, "").Code)
+
+			output := buf.String()
+			require.Contains(t, output, "Patient retrieved successfully")
+			require.Contains(t, output, "Login failed - invalid password")
+			for _, value := range pii {
+				assert.NotContains(t, output, value)
+			}
+		})
+	}
+}
+
+func TestRouterClientIP(t *testing.T) {
+	hospital := models.Hospital{ID: uuid.New(), Code: "hn-001"}
+	staff := repository.NewMemoryStaffRepository(hospital)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = staff.Create(context.Background(), hospital.ID.String(), "somchai.j", string(hash), []string{middleware.RoleClerk})
+	require.NoError(t, err)
+
+	// loginIP logs in from a proxy at 10.0.0.5 that forwards for 203.0.113.9,
+	// and returns the IP address the login was audited with.
+	loginIP := func(trustedProxies []string) string {
+		audit := repository.NewMemoryAuditRepository()
+		router := NewRouter(&service.Service{
+			Logger:   slog.New(slog.DiscardHandler),
+			Patients: repository.NewMemoryPatientRepository(0.25),
+			Staff:    staff,
+			Audit:    audit,
+		}, &Config{ServiceName: "test", TrustedProxies: trustedProxies})
+
+		req := httptest.NewRequest("POST", "/staff/login", bytes.NewBufferString(`{"username": "somchai.j", "password": "password123", "hospital": "hn-001"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		req.RemoteAddr = "10.0.0.5:41234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		events, _, err := audit.List(context.Background(), repository.AuditFilter{HospitalID: hospital.ID.String()}, 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		return events[0].IPAddress
+	}
+
+	assert.Equal(t, "10.0.0.5", loginIP(nil), "untrusted forwarding headers are ignored")
+	assert.Equal(t, "203.0.113.9", loginIP([]string{"10.0.0.0/8"}))
+}
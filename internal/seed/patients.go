@@ -0,0 +1,178 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"agnos_demo/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type patient struct {
+	firstNameTH string
+	lastNameTH  string
+	firstNameEN string
+	lastNameEN  string
+	dateOfBirth string
+	gender      string
+	nationalID  string
+	passportID  string
+	phoneNumber string
+	email       string
+}
+
+type name struct {
+	th string
+	en string
+}
+
+var (
+	maleNames = []name{
+		{"สมชาย", "Somchai"}, {"สมศักดิ์", "Somsak"}, {"ประเสริฐ", "Prasert"}, {"วิชัย", "Wichai"},
+		{"สุรชัย", "Surachai"}, {"อนุชา", "Anucha"}, {"ธนากร", "Thanakorn"}, {"ณัฐพล", "Natthaphon"},
+		{"กิตติ", "Kitti"}, {"พงศกร", "Phongsakorn"}, {"วีระ", "Weera"}, {"ชัยวัฒน์", "Chaiwat"},
+	}
+	femaleNames = []name{
+		{"สมศรี", "Somsri"}, {"มาลี", "Malee"}, {"สุภาพร", "Supaporn"}, {"วันเพ็ญ", "Wanphen"},
+		{"นภัสสร", "Naphatson"}, {"กัญญา", "Kanya"}, {"ปิยะนุช", "Piyanut"}, {"อรุณี", "Arunee"},
+		{"จันทร์เพ็ญ", "Chanphen"}, {"ศิริพร", "Siriporn"}, {"พิมพ์ชนก", "Phimchanok"}, {"รัตนา", "Rattana"},
+	}
+	familyNames = []name{
+		{"ใจดี", "Jaidee"}, {"สุขสวัสดิ์", "Suksawat"}, {"ศรีสุข", "Srisuk"}, {"วงศ์ไทย", "Wongthai"},
+		{"แก้วมณี", "Kaewmanee"}, {"ทองดี", "Thongdee"}, {"บุญมา", "Boonma"}, {"รัตนพันธ์", "Rattanaphan"},
+		{"จันทร์แก้ว", "Chankaew"}, {"พรหมมา", "Phromma"}, {"สายทอง", "Saithong"}, {"เพชรรัตน์", "Phetcharat"},
+	}
+)
+
+// syntheticPatients generates count patients for a hospital. The same
+// hospital and index always yield the same patient, so loading a set again
+// with the same count adds nobody, and a larger count only adds the rest.
+func syntheticPatients(hospitalCode string, count int) []patient {
+	seed := fnv.New64a()
+	seed.Write([]byte(hospitalCode))
+	rng := rand.New(rand.NewPCG(seed.Sum64(), 0))
+
+	earliest := time.Date(1940, 1, 1, 0, 0, 0, 0, time.UTC)
+	days := int(time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC).Sub(earliest).Hours() / 24)
+
+	patients := make([]patient, 0, count)
+	for i := 0; i < count; i++ {
+		gender, first := "M", maleNames[rng.IntN(len(maleNames))]
+		if rng.IntN(2) == 0 {
+			gender, first = "F", femaleNames[rng.IntN(len(femaleNames))]
+		}
+		last := familyNames[rng.IntN(len(familyNames))]
+
+		p := patient{
+			firstNameTH: first.th,
+			lastNameTH:  last.th,
+			firstNameEN: first.en,
+			lastNameEN:  last.en,
+			dateOfBirth: earliest.AddDate(0, 0, rng.IntN(days)).Format("2006-01-02"),
+			gender:      gender,
+			phoneNumber: fmt.Sprintf("+668%08d", rng.IntN(100000000)),
+		}
+
+		// One in ten is a foreign patient known by passport only.
+		if rng.IntN(10) == 0 {
+			p.passportID = fmt.Sprintf("%c%c%07d", 'A'+rune(rng.IntN(26)), 'A'+rune(rng.IntN(26)), rng.IntN(10000000))
+		} else {
+			p.nationalID = nationalID(rng)
+		}
+		if rng.IntN(2) == 0 {
+			p.email = strings.ToLower(fmt.Sprintf("%s.%s.%s.%d@example.com", first.en, last.en, strings.ReplaceAll(hospitalCode, "-", ""), i+1))
+		}
+		patients = append(patients, p)
+	}
+	return patients
+}
+
+// nationalID returns a random Thai national ID with a valid check digit.
+func nationalID(rng *rand.Rand) string {
+	digits := make([]byte, 13)
+	digits[0] = byte('1' + rng.IntN(8))
+	for i := 1; i < 12; i++ {
+		digits[i] = byte('0' + rng.IntN(10))
+	}
+
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(digits[i]-'0') * (13 - i)
+	}
+	digits[12] = byte('0' + (11-sum%11)%10)
+	return string(digits)
+}
+
+// insertPatients creates the persons that do not exist yet and registers
+// every person not already registered at the hospital, with the phone number
+// and email of the seeded patient, leaving out an email the hospital already
+// has. Persons conflicting with an existing national ID or passport are left
+// as they are.
+func insertPatients(ctx context.Context, tx pgx.Tx, hospitalCode string, patients []patient) (int64, error) {
+	var registered int64
+	for start := 0; start < len(patients); start += database.BatchSize {
+		batch := patients[start:min(start+database.BatchSize, len(patients))]
+
+		columns := make([][]string, 10)
+		for _, p := range batch {
+			for i, value := range []string{
+				p.firstNameTH, p.lastNameTH, p.firstNameEN, p.lastNameEN, p.dateOfBirth,
+				p.gender, p.nationalID, p.passportID, p.phoneNumber, p.email,
+			} {
+				columns[i] = append(columns[i], value)
+			}
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO persons (
+				first_name_th, last_name_th, first_name_en, last_name_en, date_of_birth,
+				gender, national_id, passport_id
+			)
+			SELECT
+				first_name_th, last_name_th, first_name_en, last_name_en, date_of_birth::date,
+				gender::gender_enum, NULLIF(national_id, ''), NULLIF(passport_id, '')
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::text[])
+				AS t(first_name_th, last_name_th, first_name_en, last_name_en, date_of_birth, gender, national_id, passport_id)
+			ON CONFLICT DO NOTHING
+		`, columns[0], columns[1], columns[2], columns[3], columns[4], columns[5], columns[6], columns[7])
+		if err != nil {
+			return 0, fmt.Errorf("unable to seed persons: %w", err)
+		}
+
+		// Inserting only unregistered persons, rather than relying on a
+		// conflict, keeps the hospital number sequence free of gaps.
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO patients (person_id, hospital_id, phone_number, email)
+			SELECT person_id, hospital_id, phone_number, email
+			FROM (
+				SELECT DISTINCT ON (p.id)
+					p.id AS person_id, h.id AS hospital_id, p.created_at,
+					NULLIF(t.phone_number, '') AS phone_number,
+					CASE WHEN NOT EXISTS (
+						SELECT 1 FROM patients e
+						WHERE e.hospital_id = h.id AND e.email = t.email AND e.deleted_at IS NULL
+					) THEN NULLIF(t.email, '') END AS email
+				FROM unnest($2::text[], $3::text[], $4::text[], $5::text[]) AS t(national_id, passport_id, phone_number, email)
+				JOIN persons p ON p.national_id = NULLIF(t.national_id, '') OR p.passport_id = NULLIF(t.passport_id, '')
+				CROSS JOIN hospitals h
+				WHERE h.code = $1
+					AND NOT EXISTS (
+						SELECT 1 FROM patients r
+						WHERE r.person_id = p.id AND r.hospital_id = h.id AND r.deleted_at IS NULL
+					)
+				ORDER BY p.id
+			) registrations
+			ORDER BY created_at, person_id
+		`, hospitalCode, columns[6], columns[7], columns[8], columns[9])
+		if err != nil {
+			return 0, fmt.Errorf("unable to register seeded patients at %s: %w", hospitalCode, err)
+		}
+		registered += tag.RowsAffected()
+	}
+	return registered, nil
+}
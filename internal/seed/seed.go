@@ -0,0 +1,87 @@
+// Package seed loads named sets of sample data into non-production
+// databases. Seeds are kept apart from migrations so that sample accounts
+// never reach production, and every set can be loaded repeatedly without
+// duplicating data.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"agnos_demo/internal/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Environments a seed set may be loaded into, matching App.Environment.
+const (
+	EnvironmentDev  = "dev"
+	EnvironmentTest = "test"
+	EnvironmentDemo = "demo"
+)
+
+type Options struct {
+	// PatientsPerHospital is the number of synthetic patients generated for
+	// each hospital of the set. Negative uses the set's default.
+	PatientsPerHospital int
+}
+
+type Set struct {
+	Name        string
+	Description string
+	// Environments the set may be loaded into.
+	Environments []string
+	// DefaultPatients is the number of synthetic patients per hospital
+	// generated unless overridden.
+	DefaultPatients int
+	Run             func(ctx context.Context, tx pgx.Tx, logger *slog.Logger, patients int) error
+}
+
+// Sets lists the available seed sets.
+var Sets = []*Set{devSet, testSet, demoSet}
+
+// Seed loads the named set in a single transaction, refusing sets not meant
+// for the given environment.
+func Seed(logger *slog.Logger, name string, environment string, opts Options) error {
+	var set *Set
+	var names []string
+	for _, s := range Sets {
+		names = append(names, s.Name)
+		if s.Name == name {
+			set = s
+		}
+	}
+	if set == nil {
+		return fmt.Errorf("unknown seed set %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if !slices.Contains(set.Environments, environment) {
+		return fmt.Errorf("seed set %q cannot be loaded in the %q environment, only in %s", name, environment, strings.Join(set.Environments, ", "))
+	}
+
+	patients := set.DefaultPatients
+	if opts.PatientsPerHospital >= 0 {
+		patients = opts.PatientsPerHospital
+	}
+
+	ctx := context.Background()
+	db, err := database.ConnectDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	logger.Info("connected to database")
+
+	logger.Info("loading seed set", "set", set.Name, "environment", environment)
+	if err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		return set.Run(ctx, tx, logger, patients)
+	}); err != nil {
+		logger.Error("unable to load seed set", "set", set.Name, "error", err)
+		return err
+	}
+
+	logger.Info("seed set loaded successfully", "set", set.Name)
+	return nil
+}
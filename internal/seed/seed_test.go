@@ -0,0 +1,49 @@
+package seed
+
+import (
+	"log/slog"
+	"testing"
+
+	"agnos_demo/internal/validation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeed(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	t.Run("Unknown Set", func(t *testing.T) {
+		err := Seed(logger, "staging", EnvironmentDev, Options{PatientsPerHospital: -1})
+		assert.ErrorContains(t, err, "unknown seed set")
+	})
+
+	t.Run("Production Refused", func(t *testing.T) {
+		for _, set := range Sets {
+			err := Seed(logger, set.Name, "production", Options{PatientsPerHospital: -1})
+			assert.ErrorContains(t, err, "cannot be loaded", set.Name)
+		}
+	})
+}
+
+func TestSyntheticPatients(t *testing.T) {
+	patients := syntheticPatients("hn-001", 500)
+	assert.Len(t, patients, 500)
+
+	// The same hospital and count always yield the same patients
+	assert.Equal(t, patients, syntheticPatients("hn-001", 500))
+	assert.Equal(t, patients[:100], syntheticPatients("hn-001", 100))
+	assert.NotEqual(t, patients[:100], syntheticPatients("hn-002", 100))
+
+	for _, p := range patients {
+		if p.nationalID != "" {
+			assert.NoError(t, validation.ValidateThaiNationalID(p.nationalID))
+		} else {
+			_, err := validation.NormalizePassport(p.passportID)
+			assert.NoError(t, err)
+		}
+		_, err := validation.NormalizeThaiPhone(p.phoneNumber)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, p.firstNameTH)
+		assert.NotEmpty(t, p.lastNameEN)
+	}
+}
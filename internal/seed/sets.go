@@ -0,0 +1,130 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// passwordHash is the bcrypt hash of "password", shared by every seeded
+// staff account.
+const passwordHash = "$2a$12$VsfCQivbKsbMdc8i9jMTTO2ekdf7FBjIH9r8X1SH4UG6GFZVNsnsK"
+
+type hospital struct {
+	code string
+	name string
+}
+
+type staff struct {
+	username string
+	hospital string
+	role     string
+}
+
+var hospitals = []hospital{
+	{code: "hn-001", name: "Hospital A"},
+	{code: "hn-002", name: "Hospital B"},
+}
+
+// samplePatients are the hand-written patients of the dev and test sets,
+// by hospital code.
+var samplePatients = map[string][]patient{
+	"hn-001": {
+		{firstNameTH: "จอห์น", lastNameTH: "โด", firstNameEN: "John", lastNameEN: "Doe", dateOfBirth: "1980-01-01", gender: "M", nationalID: "9855629944793", passportID: "AB123456"},
+		{firstNameTH: "เจน", lastNameTH: "สมิธ", firstNameEN: "Jane", lastNameEN: "Smith", dateOfBirth: "1990-05-15", gender: "F", nationalID: "9220297763701", passportID: "CD654321"},
+	},
+	"hn-002": {
+		{firstNameTH: "อลิซ", lastNameTH: "จอห์นสัน", firstNameEN: "Alice", lastNameEN: "Johnson", dateOfBirth: "1985-03-20", gender: "F", nationalID: "3753395384991", passportID: "EF567890"},
+		{firstNameTH: "บ็อบ", lastNameTH: "บราวน์", firstNameEN: "Bob", lastNameEN: "Brown", dateOfBirth: "1975-11-10", gender: "M", nationalID: "5258439754182", passportID: "GH123456"},
+	},
+}
+
+var devSet = &Set{
+	Name:         "dev",
+	Description:  "An admin per hospital and a few hand-written patients",
+	Environments: []string{EnvironmentDev, EnvironmentTest},
+	Run: func(ctx context.Context, tx pgx.Tx, logger *slog.Logger, patients int) error {
+		return load(ctx, tx, logger, []staff{
+			{username: "admin", hospital: "hn-001", role: "hospital_admin"},
+			{username: "staff_b", hospital: "hn-002", role: "hospital_admin"},
+		}, true, patients)
+	},
+}
+
+var testSet = &Set{
+	Name:         "test",
+	Description:  "A staff account for every role at each hospital and a few hand-written patients",
+	Environments: []string{EnvironmentTest, EnvironmentDev},
+	Run: func(ctx context.Context, tx pgx.Tx, logger *slog.Logger, patients int) error {
+		var accounts []staff
+		for _, h := range hospitals {
+			for _, role := range []string{"hospital_admin", "clerk", "doctor", "auditor"} {
+				accounts = append(accounts, staff{username: fmt.Sprintf("%s_%s", role, h.code), hospital: h.code, role: role})
+			}
+		}
+		return load(ctx, tx, logger, accounts, true, patients)
+	},
+}
+
+var demoSet = &Set{
+	Name:            "demo",
+	Description:     "An admin per hospital and synthetic patients",
+	Environments:    []string{EnvironmentDemo, EnvironmentDev},
+	DefaultPatients: 200,
+	Run: func(ctx context.Context, tx pgx.Tx, logger *slog.Logger, patients int) error {
+		return load(ctx, tx, logger, []staff{
+			{username: "admin", hospital: "hn-001", role: "hospital_admin"},
+			{username: "staff_b", hospital: "hn-002", role: "hospital_admin"},
+		}, false, patients)
+	},
+}
+
+// load seeds the hospitals, the given staff, and optionally the sample
+// patients, then tops each hospital up with synthetic patients.
+func load(ctx context.Context, tx pgx.Tx, logger *slog.Logger, accounts []staff, samples bool, patients int) error {
+	for _, h := range hospitals {
+		_, err := tx.Exec(ctx, `INSERT INTO hospitals (code, name) VALUES ($1, $2) ON CONFLICT (code) DO NOTHING`, h.code, h.name)
+		if err != nil {
+			return fmt.Errorf("unable to seed hospital %s: %w", h.code, err)
+		}
+	}
+	logger.Info("seeded hospitals", "count", len(hospitals))
+
+	for _, s := range accounts {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO staff (username, password_hash, hospital_id)
+			SELECT $1, $2, id FROM hospitals WHERE code = $3
+			ON CONFLICT (username) DO NOTHING
+		`, s.username, passwordHash, s.hospital)
+		if err != nil {
+			return fmt.Errorf("unable to seed staff %s: %w", s.username, err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO staff_roles (staff_id, role_id)
+			SELECT s.id, r.id FROM staff s, roles r WHERE s.username = $1 AND r.name = $2
+			ON CONFLICT DO NOTHING
+		`, s.username, s.role)
+		if err != nil {
+			return fmt.Errorf("unable to seed role of staff %s: %w", s.username, err)
+		}
+	}
+	logger.Info("seeded staff accounts", "count", len(accounts))
+
+	for _, h := range hospitals {
+		var batch []patient
+		if samples {
+			batch = append(batch, samplePatients[h.code]...)
+		}
+		batch = append(batch, syntheticPatients(h.code, patients)...)
+
+		registered, err := insertPatients(ctx, tx, h.code, batch)
+		if err != nil {
+			return err
+		}
+		logger.Info("registered new patients", "count", registered, "hospital", h.code)
+	}
+	return nil
+}
@@ -1,22 +1,30 @@
 package service
 
 import (
-	"agnos_demo/internal/database"
+	"log/slog"
 
-	"github.com/sirupsen/logrus"
+	"agnos_demo/internal/database"
+	"agnos_demo/internal/repository"
 )
 
 type Service struct {
-	Logger *logrus.Logger
+	Logger *slog.Logger
 	DB     database.DB
+
+	Patients repository.PatientRepository
+	Staff    repository.StaffRepository
+	Audit    repository.AuditRepository
 }
 
 type ServiceOptions struct {
 }
 
-func NewService(logger *logrus.Logger, db database.DB, opts *ServiceOptions) (*Service, error) {
+func NewService(logger *slog.Logger, db database.DB, opts *ServiceOptions) (*Service, error) {
 	return &Service{
-		Logger: logger,
-		DB:     db,
+		Logger:   logger,
+		DB:       db,
+		Patients: repository.NewPostgresPatientRepository(db),
+		Staff:    repository.NewPostgresStaffRepository(db),
+		Audit:    repository.NewPostgresAuditRepository(db),
 	}, nil
 }
@@ -0,0 +1,103 @@
+// Package tracing sets up OpenTelemetry tracing of HTTP requests and database
+// queries, and adds trace IDs to log records.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "agnos_demo/internal/tracing"
+
+// Span exporters accepted for Tracing.Exporter.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+type Config struct {
+	ServiceName string
+	Exporter    string
+	Endpoint    string // host:port of an OTLP/HTTP collector
+	Insecure    bool
+	SampleRatio float64
+}
+
+func InitConfig() *Config {
+	return &Config{
+		ServiceName: viper.GetString("Tracing.ServiceName"),
+		Exporter:    viper.GetString("Tracing.Exporter"),
+		Endpoint:    viper.GetString("Tracing.Endpoint"),
+		Insecure:    viper.GetBool("Tracing.Insecure"),
+		SampleRatio: viper.GetFloat64("Tracing.SampleRatio"),
+	}
+}
+
+// Setup installs the W3C trace context propagator and a global tracer
+// provider sending spans to the configured exporter. The returned function
+// flushes pending spans and stops the provider.
+//
+// With the none exporter no spans are recorded, but the trace context of
+// incoming requests is still propagated, so logs carry the caller's trace ID.
+func Setup(ctx context.Context, config *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s span exporter: %w", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+		// Requests that arrive with a trace follow the caller's decision.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a span for each request, continuing the trace of an
+// incoming traceparent header. Health checks are not traced.
+//
+// The span's url.path is replaced by the route, as paths such as
+// /patient/search/:id carry national ID and passport numbers.
+func Middleware(service string) gin.HandlersChain {
+	return gin.HandlersChain{
+		otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/health"
+		})),
+		func(c *gin.Context) {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(semconv.URLPath(c.FullPath()))
+		},
+	}
+}
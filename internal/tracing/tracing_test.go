@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// recordSpans installs a tracer provider that keeps the ended spans.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), &Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), &Config{Exporter: "jaeger"})
+	assert.ErrorContains(t, err, `unknown tracing exporter "jaeger"`)
+}
+
+func TestMiddleware(t *testing.T) {
+	_, err := Setup(context.Background(), &Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	recorder := recordSpans(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware("test")...)
+	var requestSpan trace.SpanContext
+	handler := func(c *gin.Context) { requestSpan = trace.SpanContextFromContext(c.Request.Context()) }
+	r.GET("/patient/search/:id", handler)
+	r.GET("/health", handler)
+
+	req := httptest.NewRequest("GET", "/patient/search/1234567890121", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The request continues the caller's trace
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestSpan.TraceID().String())
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /patient/search/:id", spans[0].Name())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	// The patient's identifier does not end up in the span
+	for _, attr := range spans[0].Attributes() {
+		assert.NotContains(t, attr.Value.Emit(), "1234567890121", string(attr.Key))
+	}
+	assert.Contains(t, spans[0].Attributes(), semconv.URLPath("/patient/search/:id"))
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	assert.Len(t, recorder.Ended(), 1)
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := recordSpans(t)
+	tracer := NewQueryTracer()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	queryCtx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+		SQL:  "\n\t\tselect id FROM persons WHERE national_id = $1",
+		Args: []any{"1234567890121"},
+	})
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	queryCtx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "UPDATE persons SET email = $1"})
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: errors.New("duplicate key")})
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	query := spans[0]
+	assert.Equal(t, "SELECT", query.Name())
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+	attrs := map[string]string{}
+	for _, attr := range query.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	assert.Equal(t, "postgresql", attrs["db.system.name"])
+	assert.Equal(t, "1", attrs["db.response.returned_rows"])
+	// Arguments are never recorded
+	for _, value := range attrs {
+		assert.NotContains(t, value, "1234567890121")
+	}
+
+	assert.Equal(t, "UPDATE", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{"traceparent": testTraceparent})
+
+	logger.InfoContext(ctx, "traced")
+	logger.Info("untraced")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var traced, untraced map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &traced))
+	require.NoError(t, json.Unmarshal(lines[1], &untraced))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traced["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", traced["span_id"])
+	assert.Equal(t, "test", traced["component"])
+	assert.NotContains(t, untraced, "trace_id")
+}
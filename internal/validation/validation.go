@@ -0,0 +1,165 @@
+// Package validation checks and normalizes patient identifiers and contact
+// details before they are used in queries or persisted.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrNationalIDFormat   = errors.New("must be 13 digits")
+	ErrNationalIDChecksum = errors.New("checksum digit is invalid")
+	ErrPassportFormat     = errors.New("must be 5 to 20 letters or digits")
+	ErrPhoneFormat        = errors.New("must be a Thai phone number")
+)
+
+var passportPattern = regexp.MustCompile(`^[A-Z0-9]{5,20}$`)
+
+// FieldError describes why a single request field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every invalid field of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Add records an invalid field.
+func (e *Errors) Add(field string, err error) {
+	*e = append(*e, FieldError{Field: field, Message: err.Error()})
+}
+
+// Err returns nil when no field was recorded, so callers can return it directly.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// IsNationalIDShaped reports whether s looks like a national ID, i.e. is
+// exactly 13 ASCII digits. It does not verify the checksum.
+func IsNationalIDShaped(s string) bool {
+	if len(s) != 13 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateThaiNationalID verifies the 13-digit Thai national ID including its
+// mod-11 check digit.
+func ValidateThaiNationalID(id string) error {
+	if !IsNationalIDShaped(id) {
+		return ErrNationalIDFormat
+	}
+
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(id[i]-'0') * (13 - i)
+	}
+
+	check := (11 - sum%11) % 10
+	if check != int(id[12]-'0') {
+		return ErrNationalIDChecksum
+	}
+	return nil
+}
+
+// NormalizePassport upper-cases a passport number and strips whitespace and
+// dashes, then checks that what remains is alphanumeric.
+func NormalizePassport(passport string) (string, error) {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, passport)
+
+	if !passportPattern.MatchString(normalized) {
+		return "", ErrPassportFormat
+	}
+	return normalized, nil
+}
+
+// NormalizeThaiPhone converts a Thai phone number written in local
+// (0812345678, 02-123-4567) or international (+66 81 234 5678) form to E.164.
+func NormalizeThaiPhone(phone string) (string, error) {
+	var digits strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return "", ErrPhoneFormat
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(number, "66"):
+		// Tolerate the trunk prefix written after the country code, e.g. +66 (0)81...
+		number = strings.TrimPrefix(number[2:], "0")
+	case strings.HasPrefix(number, "0"):
+		number = number[1:]
+	default:
+		return "", ErrPhoneFormat
+	}
+
+	// National significant numbers are 8 digits for landlines and 9 for mobiles.
+	if (len(number) != 8 && len(number) != 9) || number[0] == '0' {
+		return "", ErrPhoneFormat
+	}
+	return fmt.Sprintf("+66%s", number), nil
+}
+
+// NormalizePatient validates the identifier and contact fields of a patient
+// write and replaces them with their normalized form. Nil or empty fields are
+// skipped. The returned error is of type Errors.
+func NormalizePatient(nationalID, passportID, phoneNumber *string) error {
+	var errs Errors
+
+	if nationalID != nil && *nationalID != "" {
+		if err := ValidateThaiNationalID(*nationalID); err != nil {
+			errs.Add("national_id", err)
+		}
+	}
+
+	if passportID != nil && *passportID != "" {
+		normalized, err := NormalizePassport(*passportID)
+		if err != nil {
+			errs.Add("passport_id", err)
+		} else {
+			*passportID = normalized
+		}
+	}
+
+	if phoneNumber != nil && *phoneNumber != "" {
+		normalized, err := NormalizeThaiPhone(*phoneNumber)
+		if err != nil {
+			errs.Add("phone_number", err)
+		} else {
+			*phoneNumber = normalized
+		}
+	}
+
+	return errs.Err()
+}
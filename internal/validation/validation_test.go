@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateThaiNationalID(t *testing.T) {
+	assert.NoError(t, ValidateThaiNationalID("1234567890121"))
+	assert.NoError(t, ValidateThaiNationalID("9855629944793"))
+	assert.ErrorIs(t, ValidateThaiNationalID("1234567890123"), ErrNationalIDChecksum)
+	assert.ErrorIs(t, ValidateThaiNationalID("123456789012"), ErrNationalIDFormat)
+	assert.ErrorIs(t, ValidateThaiNationalID("12345678901A1"), ErrNationalIDFormat)
+}
+
+func TestNormalizePassport(t *testing.T) {
+	passport, err := NormalizePassport(" ab 123-456 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "AB123456", passport)
+
+	_, err = NormalizePassport("AB/123456")
+	assert.ErrorIs(t, err, ErrPassportFormat)
+}
+
+func TestNormalizeThaiPhone(t *testing.T) {
+	cases := map[string]string{
+		"0812345678":        "+66812345678",
+		"081-234-5678":      "+66812345678",
+		"+66 81 234 5678":   "+66812345678",
+		"+66 (0)81 2345678": "+66812345678",
+		"02-123-4567":       "+6621234567",
+	}
+	for input, expected := range cases {
+		phone, err := NormalizeThaiPhone(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, phone, input)
+	}
+
+	for _, input := range []string{"12345", "081234567890", "+1 415 555 0100", "08l2345678"} {
+		_, err := NormalizeThaiPhone(input)
+		assert.ErrorIs(t, err, ErrPhoneFormat, input)
+	}
+}
+
+func TestNormalizePatient(t *testing.T) {
+	nationalID := "1234567890123"
+	passportID := "ab 123456"
+	phone := "0812345678"
+
+	err := NormalizePatient(&nationalID, &passportID, &phone)
+
+	var errs Errors
+	assert.ErrorAs(t, err, &errs)
+	assert.Equal(t, Errors{{Field: "national_id", Message: ErrNationalIDChecksum.Error()}}, errs)
+	assert.Equal(t, "AB123456", passportID)
+	assert.Equal(t, "+66812345678", phone)
+
+	assert.NoError(t, NormalizePatient(nil, nil, nil))
+}